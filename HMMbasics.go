@@ -1,7 +1,8 @@
-//This file has functions: PrHiddenPath, PrStrGivenPath, Forward
-package main
+//This file has functions: PrHiddenPath, PrStrGivenPath, Forward, and the null model maps.
+package profilehmm
 
 import (
+  "math"
   "strings"
 )
 
@@ -32,28 +33,169 @@ func PrHiddenPath(startpoint int, pathStr string, states []string, trmap MtxMap)
 }
 
 //Input: A string x, Σ , States, transition map, and emission map of an HMM (Σ, States, Transition, Emission).
-//output: The probability Pr(x) that the HMM emits x.
-func Forward(str string, sigma, states []string, trmap, emimap MtxMap) (pr float64) {
-	if len(str) == 0 {
-		return
+//The start point is a integer indicating whether there is invisible states, the
+//same way as in ViterbiDecoding. If it's 1, the paths start from the invisible
+//state "Start", go through the deletion states without emitting, and end in "End".
+//Otherwise each state have equal opportunity as a starting state.
+//output: The log probability ln Pr(x) that the HMM emits x. It is computed in log
+//space, so it does not underflow to log(0) for long strings.
+func Forward(startpoint int, str string, sigma, states []string, trmap, emimap MtxMap) float64 {
+	tr := NewTransitions(MapToDense(states, states, trmap))
+	emi := MapToDense(states, sigma, emimap)
+	return ForwardIndexed(startpoint, emi.Encode(str), tr, emi)
+}
+
+//ForwardIndexed is Forward on the sparse transitions and the dense emission
+//matrix, which share the same states. The string is given as column indexes of
+//the emission matrix (see DenseMtx.Encode).
+func ForwardIndexed(startpoint int, seq []int, tr *Transitions, emi *DenseMtx) float64 {
+	if len(seq) == 0 {
+		return math.Inf(-1)
+	}
+	if startpoint == 1 {
+		forwardMtx := FillForwardWithHiddenStates(seq, tr, emi)
+		return forwardMtx[len(forwardMtx)-1][len(seq)] //in "End" after emitting the whole string
+	}
+
+	forwardMtx := FillForwardNoHiddenStates(seq, tr, emi)
+	logPr := math.Inf(-1)
+	for f2 := range forwardMtx {
+		logPr = LogAdd(logPr, forwardMtx[f2][len(seq)-1])
 	}
+	return logPr
+}
+
+//FillForwardWithHiddenStates fills the forward matrix of an HMM that has states
+//without emission, like FillViterbiWithHiddenStates does for viterbi but summing
+//instead of maximizing. Each entry is the log of the probability. Column s holds
+//the paths that have emitted the first s symbols, so there are len(str)+1 columns.
+//The paths start in the first state ("Start"); deletion states and "End" take
+//their value from the same column since they do not emit.
+func FillForwardWithHiddenStates(seq []int, tr *Transitions, emi *DenseMtx) [][]float64 {
+	var sum float64
+	states := tr.States
 	forwardMtx := make([][]float64, len(states))
+	for f := range forwardMtx {
+		forwardMtx[f] = make([]float64, len(seq)+1)
+		for s := range forwardMtx[f] {
+			forwardMtx[f][s] = math.Inf(-1)
+		}
+	}
+	forwardMtx[0][0] = 0
+
+	for s := 0; s <= len(seq); s++ {
+		for f2 := 1; f2 < len(states); f2++ {
+			sum = math.Inf(-1)
+			if states[f2][0:1] == "D" || states[f2][0:1] == "E" {
+				for i, f1 := range tr.From[f2] { //same column, no emission for hidden states
+					sum = LogAdd(sum, forwardMtx[f1][s]+tr.LogProb[f2][i])
+				}
+			} else if s > 0 {
+				for i, f1 := range tr.From[f2] {
+					sum = LogAdd(sum, forwardMtx[f1][s-1]+tr.LogProb[f2][i])
+				}
+				sum += math.Log(emi.At(f2, seq[s-1]))
+			}
+			forwardMtx[f2][s] = sum
+		}
+	}
+	return forwardMtx
+}
+
+//FillForwardNoHiddenStates fills the forward matrix of an HMM where all states
+//emit. Each state have equal opportunity as a starting state, and each entry is
+//the log of the probability.
+func FillForwardNoHiddenStates(seq []int, tr *Transitions, emi *DenseMtx) [][]float64 {
+	numStates := len(tr.States)
+	forwardMtx := make([][]float64, numStates)
 	for f := range forwardMtx { // initialize the first colum
-		forwardMtx[f] = make([]float64, len(str))
-		forwardMtx[f][0] = 1 / float64(len(states)) * emimap[states[f]][str[0:1]]
+		forwardMtx[f] = make([]float64, len(seq))
+		forwardMtx[f][0] = math.Log(1/float64(numStates)) + math.Log(emi.At(f, seq[0]))
 	}
 
-	for s := 1; s < len(str); s++ {
+	var sum, emission float64
+	for s := 1; s < len(seq); s++ {
 		for f2 := range forwardMtx {
-			for f1 := range forwardMtx {
-				forwardMtx[f2][s] += forwardMtx[f1][s-1] * trmap[states[f1]][states[f2]] * emimap[states[f2]][str[s:s+1]]
+			emission = emi.At(f2, seq[s])
+			if emission == 0 {
+				forwardMtx[f2][s] = math.Inf(-1)
+				continue
 			}
+			sum = math.Inf(-1)
+			for i, f1 := range tr.From[f2] { //only the states that can transit into f2
+				sum = LogAdd(sum, forwardMtx[f1][s-1]+tr.LogProb[f2][i])
+			}
+			forwardMtx[f2][s] = sum + math.Log(emission)
 		}
 	}
-	for f2 := range forwardMtx {
-		pr += forwardMtx[f2][len(str)-1]
+	return forwardMtx
+}
+
+//Backward takes the same input as Forward and returns the backward matrix: each
+//entry is the log probability of emitting the rest of the string from that state
+//and position. With hidden states (startpoint 1) column s is the state after the
+//first s symbols are emitted; otherwise column s is the state emitting symbol s.
+func Backward(startpoint int, str string, sigma, states []string, trmap, emimap MtxMap) [][]float64 {
+	tr := NewTransitions(MapToDense(states, states, trmap))
+	emi := MapToDense(states, sigma, emimap)
+	if startpoint == 1 {
+		return FillBackwardWithHiddenStates(emi.Encode(str), tr, emi)
+	}
+	return FillBackwardNoHiddenStates(emi.Encode(str), tr, emi)
+}
+
+//FillBackwardWithHiddenStates fills the backward matrix of an HMM that has states
+//without emission. It has len(str)+1 columns like FillForwardWithHiddenStates, and
+//the paths end in the last state ("End") after the whole string is emitted. The
+//states are visited from the last to the first, so that a deletion state can
+//take its value from the next states in the same column.
+func FillBackwardWithHiddenStates(seq []int, tr *Transitions, emi *DenseMtx) [][]float64 {
+	var sum float64
+	states := tr.States
+	backwardMtx := make([][]float64, len(states))
+	for b := range backwardMtx {
+		backwardMtx[b] = make([]float64, len(seq)+1)
+		for s := range backwardMtx[b] {
+			backwardMtx[b][s] = math.Inf(-1)
+		}
 	}
-	return
+	backwardMtx[len(states)-1][len(seq)] = 0
+
+	for s := len(seq); s >= 0; s-- {
+		for b1 := len(states) - 2; b1 >= 0; b1-- {
+			sum = math.Inf(-1)
+			for i, b2 := range tr.To[b1] {
+				if states[b2][0:1] == "D" || states[b2][0:1] == "E" {
+					sum = LogAdd(sum, tr.ToLogProb[b1][i]+backwardMtx[b2][s])
+				} else if s < len(seq) {
+					sum = LogAdd(sum, tr.ToLogProb[b1][i]+math.Log(emi.At(b2, seq[s]))+backwardMtx[b2][s+1])
+				}
+			}
+			backwardMtx[b1][s] = sum
+		}
+	}
+	return backwardMtx
+}
+
+//FillBackwardNoHiddenStates fills the backward matrix of an HMM where all states
+//emit. Any state can be the last one, so the last column is log(1) = 0.
+func FillBackwardNoHiddenStates(seq []int, tr *Transitions, emi *DenseMtx) [][]float64 {
+	var sum float64
+	backwardMtx := make([][]float64, len(tr.States))
+	for b := range backwardMtx {
+		backwardMtx[b] = make([]float64, len(seq))
+	}
+
+	for s := len(seq) - 2; s >= 0; s-- {
+		for b1 := range backwardMtx {
+			sum = math.Inf(-1)
+			for i, b2 := range tr.To[b1] {
+				sum = LogAdd(sum, tr.ToLogProb[b1][i]+math.Log(emi.At(b2, seq[s+1]))+backwardMtx[b2][s+1])
+			}
+			backwardMtx[b1][s] = sum
+		}
+	}
+	return backwardMtx
 }
 
 //The null map forms as the null hypothesis for future log likelihood calculation.
@@ -82,37 +224,43 @@ func NullTrMap(trmap MtxMap) MtxMap {
 	return Nullmap
 }
 
+//BackgroundProtein is the background existence rate of each amino acid. It is
+//the emission of the null model.
+var BackgroundProtein = map[string]float64{
+	"A": 0.074, "R": 0.042, "N": 0.044, "D": 0.059, "C": 0.033,
+	"E": 0.058, "Q": 0.037, "G": 0.074, "H": 0.029, "I": 0.038,
+	"L": 0.076, "K": 0.072, "M": 0.018, "F": 0.04, "P": 0.05,
+	"S": 0.08, "T": 0.062, "W": 0.013, "Y": 0.033, "V": 0.068,
+}
+
+//DegenerateAmino are the letters of protein sequences that stand for more than
+//one amino acid, and the amino acids of each: B is D or N, Z is E or Q, J is I
+//or L and X is any of them, while U (selenocysteine) and O (pyrrolysine) are
+//scored as the C and K they are made from. A ProfileHMM of the 20 amino acids
+//emits each with the mean of the emissions of its amino acids, weighted by the
+//null model (see DenseMtx.AddDegenerates).
+var DegenerateAmino = map[string][]string{
+	"B": {"D", "N"}, "Z": {"E", "Q"}, "J": {"I", "L"},
+	"U": {"C"}, "O": {"K"}, "X": Amino,
+}
+
 //NullEmiMapProtein takes an emimap and return the emimap with same states but
 //the emission rates are background existence rate of each amino acid.
 func NullEmiMapProtein(emimap MtxMap) MtxMap {
+	return NullEmiMap(emimap, BackgroundProtein)
+}
+
+//NullEmiMap takes an emimap and a background, and return the emimap with same
+//states but the emission rates of the emitting states are the background rates.
+func NullEmiMap(emimap MtxMap, background map[string]float64) MtxMap {
 	Nullmap := make(MtxMap, len(emimap))
 
 	for row := range emimap {
 		Nullmap[row] = make(map[string]float64, len(emimap[row]))
 		if row[0:1] != "S" && row[0:1] != "E" && row[0:1] != "D" {
-			Nullmap[row]["A"] = 0.074
-			Nullmap[row]["R"] = 0.042
-			Nullmap[row]["N"] = 0.044
-			Nullmap[row]["D"] = 0.059
-			Nullmap[row]["C"] = 0.033
-
-			Nullmap[row]["E"] = 0.058
-			Nullmap[row]["Q"] = 0.037
-			Nullmap[row]["G"] = 0.074
-			Nullmap[row]["H"] = 0.029
-			Nullmap[row]["I"] = 0.038
-
-			Nullmap[row]["L"] = 0.076
-			Nullmap[row]["K"] = 0.072
-			Nullmap[row]["M"] = 0.018
-			Nullmap[row]["F"] = 0.04
-			Nullmap[row]["P"] = 0.05
-
-			Nullmap[row]["S"] = 0.08
-			Nullmap[row]["T"] = 0.062
-			Nullmap[row]["W"] = 0.013
-			Nullmap[row]["Y"] = 0.033
-			Nullmap[row]["V"] = 0.068
+			for letter, rate := range background {
+				Nullmap[row][letter] = rate
+			}
 		}
 	}
 	return Nullmap
@@ -1,10 +1,13 @@
 //This file contains all the functions needed for viterbi decoding.
-package main
+package profilehmm
 
 import (
+	"errors"
 	"math"
 )
 
+//coordinate is a cell of the viterbi matrix: x is the state, y is the column
+//(the number of symbols emitted so far). x of -1 marks a cell without predecessor.
 type coordinate struct {
 	x int
 	y int
@@ -15,121 +18,151 @@ type coordinate struct {
 //front and end. If it's 1, then it starts from invisible state "Start" and end in "End".
 //Otherwise each state have equal opportunity as a starting state.
 //output: A path that maximizes the (unconditional) probability Pr(x, π) over all possible paths π.
-func ViterbiDecoding(startpoint int, str string, sigma, states []string, trmap, emimap MtxMap) string {
-	if len(str) == 0 {
-		panic("Can't create a path for string length 0.")
+func ViterbiDecoding(startpoint int, str string, sigma, states []string, trmap, emimap MtxMap) (string, error) {
+	tr := NewTransitions(MapToDense(states, states, trmap))
+	emi := MapToDense(states, sigma, emimap)
+	return ViterbiDecodingIndexed(startpoint, emi.Encode(str), tr, emi)
+}
+
+//ViterbiDecodingIndexed is ViterbiDecoding on the sparse transitions and the
+//dense emission matrix, which share the same states. The string is given as
+//column indexes of the emission matrix (see DenseMtx.Encode).
+func ViterbiDecodingIndexed(startpoint int, seq []int, tr *Transitions, emi *DenseMtx) (string, error) {
+	path, _, err := viterbiPath(startpoint, seq, tr, emi)
+	return path, err
+}
+
+//viterbiPath does the work of ViterbiDecodingIndexed, and also returns the log
+//probability ln Pr(x, π) of the path.
+func viterbiPath(startpoint int, seq []int, tr *Transitions, emi *DenseMtx) (string, float64, error) {
+	if len(seq) == 0 {
+		return "", 0, errors.New("can't create a path for string length 0")
 	}
 	var viterbi [][]float64      //len(states) x len(str)
-	var backtrace [][]coordinate //len(states) x len(str)-1
+	var backtrace [][]coordinate //len(states) x len(str)
 
 	if startpoint == 1 { // it starts from the invisible state "Start"
-		viterbi, backtrace = FillViterbiWithHiddenStates(str, sigma, states, trmap, emimap)
+		viterbi, backtrace = FillViterbiWithHiddenStates(seq, tr, emi)
 	} else {
-		viterbi, backtrace = FillViterbiNoHiddenStates(str, sigma, states, trmap, emimap)
+		viterbi, backtrace = FillViterbiNoHiddenStates(seq, tr, emi)
 	}
 
-	endingState := EndingInViterbi(startpoint, str, states, viterbi)
-	path := ViterbiTraceBack(endingState, str, states, backtrace) //Finding the path trace back from the ending state.
-	return path
+	endingState := EndingInViterbi(startpoint, viterbi)
+	logPr := viterbi[endingState.x][endingState.y]
+	if math.IsInf(logPr, -1) {
+		return "", logPr, errors.New("the string can not be emitted by the HMM")
+	}
+	path := ViterbiTraceBack(endingState, tr.States, backtrace) //Finding the path trace back from the ending state.
+	return path, logPr, nil
 }
 
 //If some states in the HMM have no emission (for example, deletion state does
 //not emit anything), Then use this function to fill up the viterbi matrix. It
-//takes the input string, sigma(emission options) states(for transition), transition
-//map and emision map, and return a filled viterbi matrix and a matrix to trace back the path.
-func FillViterbiWithHiddenStates(str string, sigma, states []string, trmap, emimap MtxMap) ([][]float64, [][]coordinate) {
-	var logTranEmi, max float64
-	viterbi := make([][]float64, len(states))      //len(states) x len(str)
-	backtrace := make([][]coordinate, len(states)) //len(states) x len(str)-1
-
-	for v1 := range viterbi { //Make the first volum of viterbi and backtrace...
-		viterbi[v1] = make([]float64, len(str)+1)
-		backtrace[v1] = make([]coordinate, len(str)) //-1
-		if v1 == 0 {
-			viterbi[0][0] = 1
-		} else if states[v1][0:1] == "D" { // if it's a deletions state, its the previous deletion state plus the transition probability.
-			viterbi[v1][0] = viterbi[v1-3][0] + math.Log(trmap[states[v1-3]][states[v1]])
+//takes the input string as emission indexes, the transitions and emision matrix,
+//and return a filled viterbi matrix and a matrix to trace back the path.
+//Column s of the matrix holds the paths that have emitted the first s symbols,
+//so it has len(str)+1 columns. The paths start in the first state ("Start").
+func FillViterbiWithHiddenStates(seq []int, tr *Transitions, emi *DenseMtx) ([][]float64, [][]coordinate) {
+	var logTranEmi, max, logEmi float64
+	var from coordinate
+	states := tr.States
+	viterbi := make([][]float64, len(states))      //len(states) x len(str)+1
+	backtrace := make([][]coordinate, len(states)) //len(states) x len(str)+1
+
+	for v := range viterbi {
+		viterbi[v] = make([]float64, len(seq)+1)
+		backtrace[v] = make([]coordinate, len(seq)+1)
+		for s := range viterbi[v] {
+			viterbi[v][s] = math.Inf(-1)
+			backtrace[v][s].x = -1
 		}
 	}
-	
-	//fill in up the viterbi matrix row by row.
-	for s := 1; s <= len(str); s++ {
-		for v2 := range viterbi { //each entry in v2 is the max{each v1 to v2}
+	viterbi[0][0] = 0
+
+	//fill in up the viterbi matrix column by column.
+	for s := 0; s <= len(seq); s++ {
+		for v2 := 1; v2 < len(states); v2++ { //each entry in v2 is the max{each v1 to v2}
+			max = math.Inf(-1)
+			from = coordinate{x: -1}
 			//if v2 is a deletion state, we travel along column.
 			if states[v2][0:1] == "D" || states[v2][0:1] == "E" {
-				max = viterbi[0][s] + math.Log(trmap[states[0]][states[v2]])
-				for v1 := range viterbi[0:v2] { //v1 states before v2, in viterbi at the same column as v2
-					if trmap[states[v1]][states[v2]] != 0 {
-						logTranEmi = viterbi[v1][s] + math.Log(trmap[states[v1]][states[v2]]) //no emission for hidden states
-					}
-					if logTranEmi >= max {
+				for i, v1 := range tr.From[v2] { //v1 states before v2, in viterbi at the same column as v2
+					logTranEmi = viterbi[v1][s] + tr.LogProb[v2][i] //no emission for hidden states
+					if logTranEmi > max {
 						max = logTranEmi
-						backtrace[v2][s-1].x = v1
-						backtrace[v2][s-1].y = s - 1
+						from = coordinate{v1, s}
 					}
 				}
-			} else {
-				max = viterbi[0][s-1] + math.Log(trmap[states[0]][states[v2]]) + math.Log(emimap[states[v2]][str[s-1:s]])
-				for v1 := range viterbi {
-					logTranEmi = viterbi[v1][s-1] + math.Log(trmap[states[v1]][states[v2]]) + math.Log(emimap[states[v2]][str[s-1:s]])
-					if logTranEmi >= max {
+			} else if s > 0 {
+				logEmi = math.Log(emi.At(v2, seq[s-1]))
+				for i, v1 := range tr.From[v2] {
+					logTranEmi = viterbi[v1][s-1] + tr.LogProb[v2][i] + logEmi
+					if logTranEmi > max {
 						max = logTranEmi
-						backtrace[v2][s-1].x = v1
-						backtrace[v2][s-1].y = s - 2
+						from = coordinate{v1, s - 1}
 					}
 				}
 			}
 			viterbi[v2][s] = max
+			backtrace[v2][s] = from
 		}
 	}
 	return viterbi, backtrace
 }
 
 //If all states in the HMM have emission (for example, there is no deletion), Then
-//use this function to fill up the viterbi matrix. It takes the input string, sigma(emission options)
-//states(for transition), transition map and emision map, and return a filled viterbi matrix
-//and a matrix to trace back the path.
-func FillViterbiNoHiddenStates(str string, sigma, states []string, trmap, emimap MtxMap) ([][]float64, [][]coordinate) {
-	var logTranEmi, max float64
-	viterbi := make([][]float64, len(states))      //len(states) x len(str)
-	backtrace := make([][]coordinate, len(states)) //len(states) x len(str)-1
-
-	for v1 := range viterbi {                      // initialize the first colum to eqal probabilities
-		viterbi[v1] = make([]float64, len(str))
-		backtrace[v1] = make([]coordinate, len(str)-1)
-		viterbi[v1][0] = math.Log(1/float64(len(states))) + math.Log(emimap[states[v1]][str[0:1]])
+//use this function to fill up the viterbi matrix. It takes the input string as
+//emission indexes, the transitions and emision matrix, and return a filled
+//viterbi matrix and a matrix to trace back the path.
+func FillViterbiNoHiddenStates(seq []int, tr *Transitions, emi *DenseMtx) ([][]float64, [][]coordinate) {
+	var logTranEmi, max, logEmi float64
+	var from coordinate
+	numStates := len(tr.States)
+	viterbi := make([][]float64, numStates)      //len(states) x len(str)
+	backtrace := make([][]coordinate, numStates) //len(states) x len(str)
+
+	for v1 := range viterbi { // initialize the first colum to eqal probabilities
+		viterbi[v1] = make([]float64, len(seq))
+		backtrace[v1] = make([]coordinate, len(seq))
+		viterbi[v1][0] = math.Log(1/float64(numStates)) + math.Log(emi.At(v1, seq[0]))
+		backtrace[v1][0].x = -1
 	}
-	//fill in up the viterbi matrix row by row.
-	for s := 1; s < len(str); s++ {
+	//fill in up the viterbi matrix column by column.
+	for s := 1; s < len(seq); s++ {
 		for v2 := range viterbi { //each entry in v2 is the max{each v1 to v2}
-			max = viterbi[0][s-1] + math.Log(trmap[states[0]][states[v2]]) + math.Log(emimap[states[v2]][str[s:s+1]])
-			for v1 := range viterbi {
-				logTranEmi = viterbi[v1][s-1] + math.Log(trmap[states[v1]][states[v2]]) + math.Log(emimap[states[v2]][str[s:s+1]])
-				if logTranEmi >= max {
+			logEmi = math.Log(emi.At(v2, seq[s]))
+			max = math.Inf(-1)
+			from = coordinate{x: -1}
+			for i, v1 := range tr.From[v2] {
+				logTranEmi = viterbi[v1][s-1] + tr.LogProb[v2][i] + logEmi
+				if logTranEmi > max {
 					max = logTranEmi
-					backtrace[v2][s-1].x = v1
-					backtrace[v2][s-1].y = s - 2
+					from = coordinate{v1, s - 1}
 				}
 			}
 			viterbi[v2][s] = max
+			backtrace[v2][s] = from
 		}
 	}
 	return viterbi, backtrace
 }
 
-//Find the ending state in Viterbi matrix. The ending state of the viterbi matrix
-//is the maximum value of the last column.
-func EndingInViterbi(startpoint int, str string, states []string, viterbi [][]float64) coordinate {
+//Find the ending state in Viterbi matrix. With hidden states, the path ends in
+//the last state ("End") after all symbols are emitted. Otherwise, the ending
+//state of the viterbi matrix is the maximum value of the last column.
+func EndingInViterbi(startpoint int, viterbi [][]float64) coordinate {
 	var endingState coordinate
+	last := len(viterbi[0]) - 1
+	endingState.y = last
 
 	if startpoint == 1 {
-		endingState.x = len(states) - 1
+		endingState.x = len(viterbi) - 1
 	} else {
 		//Finding the max value in the last column of viterbi, as well as the ending state
-		max := viterbi[0][len(str)-1]
+		max := viterbi[0][last]
 		for vf := range viterbi {
-			if viterbi[vf][len(str)-1] >= max {
-				max = viterbi[vf][len(str)-1]
+			if viterbi[vf][last] >= max {
+				max = viterbi[vf][last]
 				endingState.x = vf //the vf th states
 			}
 		}
@@ -137,12 +170,12 @@ func EndingInViterbi(startpoint int, str string, states []string, viterbi [][]fl
 	return endingState
 }
 
-//Trace back viterbi path from the ending state through backtrace mtx.
-func ViterbiTraceBack(endingState coordinate, str string, states []string, backtrace [][]coordinate) string {
+//Trace back viterbi path from the ending state through backtrace mtx, until a
+//cell without predecessor is reached.
+func ViterbiTraceBack(endingState coordinate, states []string, backtrace [][]coordinate) string {
 	path := states[endingState.x] //x is the state, y is the position of the str
-	endingState.y = len(backtrace[0]) - 1
 
-	for endingState.x > 0 {
+	for backtrace[endingState.x][endingState.y].x >= 0 {
 		endingState = backtrace[endingState.x][endingState.y]
 		path = states[endingState.x] + " " + path
 	}
@@ -0,0 +1,306 @@
+//This file lets a sequence be aligned to a part of the model, or the model to a
+//part of the sequence. The maps built by ProfileMaps are global: Start goes into
+//the first node and the last node goes to End, so the whole sequence has to be
+//aligned to the whole model. That is right for a domain cut out of a protein,
+//but a full length protein of 1,200 residues has a 60 residue SH3 domain
+//somewhere in it. Like HMMER, the other modes add two flanking states that emit
+//the residues before (N) and after (C) the domain with the background rates:
+//   Start -> N -> (entry into the model) ... (exit out of the model) -> C -> End
+//In glocal mode the domain still goes through the whole model; in local mode it
+//may enter at any match state and leave after any match state, so a fragment of
+//the domain is found too.
+//The flanks are configured for the length of each sequence: N and C loop with
+//probability L/(L+2), so together they expect to emit the L residues around the
+//domain, and the null model of HMMER (background emissions and a length of L on
+//average) is used for the scores, so the flanks cancel out between the two.
+//For proteins with many copies of a domain, like the tandem C2H2 zinc fingers,
+//multi-domain models also have a J state, which emits the residues between two
+//copies and goes back into the model, so the path goes through it again.
+
+package profilehmm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+//AlignMode is how a sequence is aligned to the model.
+type AlignMode string
+
+//The align modes. The empty mode is Global.
+const (
+	Global AlignMode = "global" //the whole sequence through the whole model
+	Glocal AlignMode = "glocal" //the whole model to a part of the sequence
+	Local  AlignMode = "local"  //a part of the model to a part of the sequence
+)
+
+//ParseAlignMode returns the mode of the given name.
+func ParseAlignMode(name string) (AlignMode, error) {
+	switch mode := AlignMode(strings.ToLower(name)); mode {
+	case "", Global:
+		return Global, nil
+	case Glocal, Local:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown align mode %q, use global, glocal or local", name)
+}
+
+//normal returns the mode with the empty mode as Global.
+func (mode AlignMode) normal() AlignMode {
+	if mode == "" {
+		return Global
+	}
+	return mode
+}
+
+//FlankedHeader returns the states of the model in glocal and local mode: Start,
+//N, J (only for multi-domain models), the states of MakeMapHeader between Start
+//and End, C and End. The flanking states come before and after the states they
+//lead to, as Forward and Viterbi need for the states that do not emit.
+func FlankedHeader(numMatch int, multi bool) []string {
+	core := MakeMapHeader(numMatch)
+	states := make([]string, 0, len(core)+3)
+	states = append(states, "Start", "N")
+	if multi {
+		states = append(states, "J")
+	}
+	states = append(states, core[1:len(core)-1]...)
+	return append(states, "C", "End")
+}
+
+//configure returns the transitions and emissions to align a sequence of the
+//given length in the mode. Global mode is the model itself. In the other modes,
+//the states are those of FlankedHeader:
+//1. Start and N go into the model with the entry distribution, or to N to emit
+//   one more flanking residue. In glocal mode the entry distribution is the one
+//   of Start in the model (into I0, M1 and D1); in local mode it goes into Mk
+//   with probability 2(M-k+1)/(M(M+1)), as in HMMER, which favours the start of
+//   the model a little.
+//2. The states of the model go to each other as in the model.
+//3. The states that go to End in the model leave the model with that
+//   probability; in local mode, every match state also leaves with probability
+//   1. This is the same as HMMER, and makes local alignments as likely to end
+//   at any match state; the model does not sum to 1 any more, which the log odds
+//   scores do not need.
+//4. Leaving the model goes to C, or to End without any C residue. C loops.
+//5. In a multi-domain model, leaving the model goes to J or to C with the same
+//   probability, as in HMMER. J emits at least one residue, loops, and goes into
+//   the model with the entry distribution like N. The loops of N, C and J then
+//   share the length of the sequence: L/(L+3).
+//A multi-domain model in global mode is the model itself, which has no flanks.
+func (hmm *ProfileHMM) configure(mode AlignMode, multi bool, length int) (*Transitions, *DenseMtx, error) {
+	mode = mode.normal()
+	if mode == Global {
+		return hmm.tr, hmm.emi, nil
+	}
+	numMatch, ok := ProfileLength(hmm.States)
+	if !ok || numMatch == 0 {
+		return nil, nil, fmt.Errorf("%s mode needs a profile HMM with match states", mode)
+	}
+	core := hmm.States
+	coreEnd := len(core) - 1
+	states := FlankedHeader(numMatch, multi)
+	shift := 1 //state c of the model (between Start and End) is state c+shift.
+	n, j, c, end := 1, 2, len(states)-2, len(states)-1
+	if multi {
+		shift = 2
+	}
+
+	emi := NewDenseMtx(states, hmm.Alphabet)
+	emi.AddDegenerates(DegenerateAmino, hmm.Null) //the same indexes as in hmm.emi
+	for v := 1; v < coreEnd; v++ {
+		copy(emi.Row(v+shift), hmm.emi.Row(v))
+	}
+	for a, letter := range hmm.Alphabet {
+		emi.Set(n, a, hmm.Null[letter])
+		emi.Set(c, a, hmm.Null[letter])
+		if multi {
+			emi.Set(j, a, hmm.Null[letter])
+		}
+	}
+
+	entry := make([]float64, len(core))
+	exit := make([]float64, len(core))
+	if mode == Local {
+		for k := 1; k <= numMatch; k++ {
+			entry[3*k-1] = 2 * float64(numMatch-k+1) / float64(numMatch*(numMatch+1))
+		}
+	} else {
+		for i, v := range hmm.tr.To[0] {
+			entry[v] = math.Exp(hmm.tr.ToLogProb[0][i])
+		}
+	}
+	for i, v := range hmm.tr.From[coreEnd] {
+		exit[v] = hmm.tr.Prob[coreEnd][i]
+	}
+	if mode == Local {
+		for k := 1; k <= numMatch; k++ {
+			exit[3*k-1] = 1
+		}
+	}
+
+	loop := float64(length) / float64(length+2)
+	toC := 1.0 //of leaving the model
+	if multi {
+		loop = float64(length) / float64(length+3)
+		toC = 0.5
+	}
+	tr := newTransitions(states)
+	tr.add(0, n, loop)
+	tr.add(n, n, loop)
+	if multi {
+		tr.add(j, j, loop)
+	}
+	for v, pr := range entry {
+		if pr > 0 {
+			tr.add(0, v+shift, (1-loop)*pr)
+			tr.add(n, v+shift, (1-loop)*pr)
+			if multi {
+				tr.add(j, v+shift, (1-loop)*pr)
+			}
+		}
+	}
+	for v2 := 1; v2 < coreEnd; v2++ {
+		for i, v1 := range hmm.tr.From[v2] {
+			if v1 != 0 {
+				tr.add(v1+shift, v2+shift, hmm.tr.Prob[v2][i])
+			}
+		}
+	}
+	for v, pr := range exit {
+		if pr > 0 {
+			tr.add(v+shift, c, pr*toC*loop)
+			tr.add(v+shift, end, pr*toC*(1-loop))
+			if multi {
+				tr.add(v+shift, j, pr*(1-toC))
+			}
+		}
+	}
+	tr.add(c, c, loop)
+	tr.add(c, end, 1-loop)
+	return tr, emi, nil
+}
+
+//nullScore returns ln Pr(x|null) of the encoded sequence for the mode. Global
+//mode uses the null model of the maps (see NullModel). The other modes use the
+//null model of HMMER: each residue is emitted with its background rate, and the
+//length is geometric with a mean of L, so that it loops with L/(L+1).
+func (hmm *ProfileHMM) nullScore(mode AlignMode, seq []int) float64 {
+	if mode.normal() == Global {
+		return ForwardIndexed(hmm.startpoint(), seq, hmm.nullTr, hmm.nullEmi)
+	}
+	background := make([]float64, len(hmm.Alphabet))
+	for a, letter := range hmm.Alphabet {
+		background[a] = hmm.Null[letter]
+	}
+	length := float64(len(seq))
+	score := length*math.Log(length/(length+1)) - math.Log(length+1)
+	for _, a := range seq {
+		if a < 0 {
+			return math.Inf(-1)
+		}
+		score += math.Log(hmm.emi.Mix(background, a))
+	}
+	return score
+}
+
+//ScoreMode is Score in the given align mode: ln Pr(x|profile) - ln Pr(x|null),
+//with the profile and the null model of the mode.
+func (hmm *ProfileHMM) ScoreMode(mode AlignMode, str string) (float64, error) {
+	if len(str) == 0 {
+		return 0, errors.New("can't score a string of length 0")
+	}
+	seq := hmm.emi.Encode(str)
+	tr, emi, err := hmm.configure(mode, false, len(seq))
+	if err != nil {
+		return 0, err
+	}
+	Ha := ForwardIndexed(hmm.modeStartpoint(mode), seq, tr, emi)
+	if math.IsInf(Ha, -1) {
+		return 0, errors.New("the string can not be emitted by the HMM")
+	}
+	return Ha - hmm.nullScore(mode, seq), nil
+}
+
+//DecodeMode is Decode in the given align mode. The path goes through N and C
+//for the residues outside of the domain, and the probability of the path is
+//the product of its transitions in the configured model.
+func (hmm *ProfileHMM) DecodeMode(mode AlignMode, str string) (path string, prPath float64, err error) {
+	if mode.normal() == Global {
+		return hmm.Decode(str)
+	}
+	seq := hmm.emi.Encode(str)
+	tr, emi, err := hmm.configure(mode, false, len(seq))
+	if err != nil {
+		return "", 0, err
+	}
+	path, _, err = viterbiPath(1, seq, tr, emi)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, math.Exp(pathLogPr(tr, path)), nil
+}
+
+//PosteriorMode is Posterior in the given align mode; the states of the result
+//are those of FlankedHeader (without J) outside of global mode.
+func (hmm *ProfileHMM) PosteriorMode(mode AlignMode, str string) (*Posterior, error) {
+	seq := hmm.emi.Encode(str)
+	tr, emi, err := hmm.configure(mode, false, len(seq))
+	if err != nil {
+		return nil, err
+	}
+	return PosteriorDecodingIndexed(hmm.modeStartpoint(mode), seq, tr, emi)
+}
+
+//DecodeMEAMode is DecodeMEA in the given align mode.
+func (hmm *ProfileHMM) DecodeMEAMode(mode AlignMode, str string) (path string, accuracy float64, err error) {
+	seq := hmm.emi.Encode(str)
+	tr, emi, err := hmm.configure(mode, false, len(seq))
+	if err != nil {
+		return "", 0, err
+	}
+	startpoint := hmm.modeStartpoint(mode)
+	post, err := PosteriorDecodingIndexed(startpoint, seq, tr, emi)
+	if err != nil {
+		return "", 0, err
+	}
+	path, accuracy = MEADecoding(startpoint, tr, post)
+	return path, accuracy, nil
+}
+
+//modeStartpoint is the startpoint of the algorithms in the mode: the flanked
+//models always start in Start and end in End.
+func (hmm *ProfileHMM) modeStartpoint(mode AlignMode) int {
+	if mode.normal() == Global {
+		return hmm.startpoint()
+	}
+	return 1
+}
+
+//pathLogPr returns the sum of the log probabilities of the transitions along a
+//path written like the one of ViterbiDecoding, which starts in Start.
+func pathLogPr(tr *Transitions, path string) float64 {
+	index := make(map[string]int, len(tr.States))
+	for v, state := range tr.States {
+		index[state] = v
+	}
+	states := strings.Fields(path)
+	logPr := 0.0
+	for i := 1; i < len(states); i++ {
+		v1, v2 := index[states[i-1]], index[states[i]]
+		found := false
+		for j, from := range tr.From[v2] {
+			if from == v1 {
+				logPr += tr.LogProb[v2][j]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return math.Inf(-1)
+		}
+	}
+	return logPr
+}
@@ -0,0 +1,46 @@
+package profilehmm
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+//TestConfigureSumsToOne checks the transitions of the configured SH3 model. In
+//glocal mode every state but End goes on with probability 1. In local mode
+//the match states also leave the model with probability 1 (see configure), so
+//their moves inside the model sum to 1 less their End of the model, and their
+//moves out of it (to C, End and J) sum to 1.
+func TestConfigureSumsToOne(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	for _, mode := range []AlignMode{Glocal, Local} {
+		for _, multi := range []bool{false, true} {
+			tr, _, err := hmm.configure(mode, multi, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for v, state := range tr.States {
+				if state == "End" {
+					continue
+				}
+				inside, outside := 0.0, 0.0
+				for i, v2 := range tr.To[v] {
+					switch tr.States[v2] {
+					case "C", "End", "J":
+						outside += math.Exp(tr.ToLogProb[v][i])
+					default:
+						inside += math.Exp(tr.ToLogProb[v][i])
+					}
+				}
+				if mode == Local && strings.HasPrefix(state, "M") {
+					wantInside := 1 - hmm.Trmap[state]["End"]
+					if math.Abs(inside-wantInside) > 1e-9 || math.Abs(outside-1) > 1e-9 {
+						t.Errorf("%s multi %v: %s goes on with %g and leaves with %g, want %g and 1", mode, multi, state, inside, outside, wantInside)
+					}
+				} else if sum := inside + outside; math.Abs(sum-1) > 1e-9 {
+					t.Errorf("%s multi %v: transitions from %s sum to %g", mode, multi, state, sum)
+				}
+			}
+		}
+	}
+}
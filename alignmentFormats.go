@@ -0,0 +1,377 @@
+//This file puts the alignment readers behind one function, ReadAlignment, which
+//picks the reader by the name of the format, or detects the format from the
+//contents of the file. It also has the readers of the formats that multiple
+//alignment programs write: aligned FASTA (MAFFT, Clustal Omega), A2M and A3M
+//(HHblits), and Clustal and MSF.
+
+package profilehmm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+//Alignment is a multiple alignment read by ReadAlignment. Rows are the aligned
+//strings with "-" for gaps, Names the name of each row when the format has them.
+//MatchColumns marks match columns with 1 and insertion columns with 0 (like
+//MarkDeletionState) when the file says which are which, otherwise it is nil.
+//ID is the name of the family when the file gives it (the query for BLAST).
+//Start and End are the first and last residue of each row in its sequence, for
+//the formats that give them (BLAST), otherwise they are nil.
+type Alignment struct {
+	Names        []string
+	Rows         []string
+	MatchColumns []int
+	ID           string
+	Start, End   []int
+}
+
+//ReadAlignment reads an alignment in the given format: "pfam" (or "P"), "blast"
+//(or "B", the first query of the file), "stockholm" (or "S"), "fasta", "a2m",
+//"a3m", "clustal", "msf", or "auto" to detect the format from the contents
+//with DetectAlignmentFormat.
+func ReadAlignment(file io.Reader, format string) (*Alignment, error) {
+	format = strings.ToLower(format)
+	if format == "auto" || format == "" {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		format = DetectAlignmentFormat(data)
+		file = bytes.NewReader(data)
+	}
+
+	switch format {
+	case "p", "pfam":
+		rows, err := ReadAlignmentsPfam(file)
+		if err != nil {
+			return nil, err
+		}
+		return &Alignment{Rows: rows}, nil
+	case "b", "blast":
+		blasts, err := ReadBLAST(file)
+		if err != nil {
+			return nil, err
+		}
+		align := &Alignment{ID: blasts[0].Query}
+		for _, row := range blasts[0].Rows {
+			align.Names = append(align.Names, row.Name)
+			align.Rows = append(align.Rows, row.Row)
+			align.Start = append(align.Start, row.Start)
+			align.End = append(align.End, row.End)
+		}
+		return align, nil
+	case "s", "stockholm":
+		sto, err := ReadAlignmentsStockholm(file)
+		if err != nil {
+			return nil, err
+		}
+		align := &Alignment{Names: sto.Names, Rows: sto.Alignments, ID: sto.GF["ID"]}
+		if _, ok := sto.GC["RF"]; ok {
+			if align.MatchColumns, err = sto.MatchColumns(); err != nil {
+				return nil, err
+			}
+		}
+		return align, nil
+	case "fasta", "afa":
+		return ReadAlignmentsFasta(file)
+	case "a2m", "a3m":
+		return ReadAlignmentsA2M(file)
+	case "clustal", "aln":
+		return ReadAlignmentsClustal(file)
+	case "msf":
+		return ReadAlignmentsMSF(file)
+	}
+	return nil, fmt.Errorf("unknown alignment format %q", format)
+}
+
+//DetectAlignmentFormat guesses the format of an alignment file from its first
+//lines: the Stockholm, Clustal and MSF headers; the program line ("BLASTP
+//2.12.0+" and the like), "Query" line, XML or tab separated columns of BLAST;
+//and ">" for the FASTA family, where lower case letters or "." mean A2M (or A3M
+//if the rows are not all of the same length). Other lines starting with "#",
+//like the "#A3M#" line of HHblits, are comments and skipped, as readRawFasta
+//does. Anything else is taken as the two column Pfam format.
+func DetectAlignmentFormat(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "# STOCKHOLM"):
+			return "stockholm"
+		case strings.HasPrefix(line, "CLUSTAL") || strings.HasPrefix(line, "MUSCLE"):
+			return "clustal"
+		case strings.HasPrefix(line, "!!AA_MULTIPLE_ALIGNMENT") || strings.HasPrefix(line, "PileUp") || strings.Contains(line, " MSF: "):
+			return "msf"
+		case strings.HasPrefix(line, "Query") || strings.HasPrefix(line, "<?xml") || strings.HasPrefix(line, "<BlastOutput") || strings.HasPrefix(line, "# BLAST"):
+			return "blast"
+		case strings.HasPrefix(line, "#"): //comment lines before the records
+			continue
+		case isBLASTProgramLine(line): //text output starts with the program and its version, then the references
+			return "blast"
+		case strings.Count(line, "\t") >= 13: //tabular BLAST output with qseq and sseq
+			return "blast"
+		case strings.HasPrefix(line, ">"):
+			_, seqs, err := readRawFasta(bytes.NewReader(data))
+			if err != nil || len(seqs) == 0 {
+				return "fasta"
+			}
+			format := "fasta"
+			for _, seq := range seqs {
+				if len(seq) != len(seqs[0]) {
+					return "a3m"
+				}
+				if strings.ContainsAny(seq, ".abcdefghijklmnopqrstuvwxyz") {
+					format = "a2m"
+				}
+			}
+			return format
+		}
+		return "pfam"
+	}
+	return "pfam"
+}
+
+//isBLASTProgramLine tells if the line is the first line of BLAST text output,
+//the name of the program followed by its version: BLASTN, BLASTP, BLASTX,
+//TBLASTN or TBLASTX.
+func isBLASTProgramLine(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return false
+	}
+	switch fields[0] {
+	case "BLASTN", "BLASTP", "BLASTX", "TBLASTN", "TBLASTX":
+		return fields[1][0] >= '0' && fields[1][0] <= '9'
+	}
+	return false
+}
+
+//ReadAlignmentsFasta reads an aligned FASTA file. Gaps may be "-" or ".", and
+//letters are turned to upper case. All rows need to be of the same length.
+func ReadAlignmentsFasta(file io.Reader) (*Alignment, error) {
+	names, seqs, err := readRawFasta(file)
+	if err != nil {
+		return nil, err
+	}
+	align := &Alignment{Names: names}
+	for _, seq := range seqs {
+		align.Rows = append(align.Rows, strings.ToUpper(strings.ReplaceAll(seq, ".", "-")))
+	}
+	return align, checkRowLengths(align)
+}
+
+//ReadAlignmentsA2M reads an A2M or A3M file. Upper case letters and "-" are in
+//match columns, lower case letters and "." are insertions. In A3M the "." are
+//left out, so the insertions are first padded to the same width in every row.
+//The match columns are returned in MatchColumns, and the rows are upper case
+//with "-" for every gap.
+func ReadAlignmentsA2M(file io.Reader) (*Alignment, error) {
+	names, seqs, err := readRawFasta(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) == 0 {
+		return nil, errors.New("a2m: no sequences found")
+	}
+
+	//split each row into the insertion before each match column, and the match columns.
+	var numMatch int
+	inserts := make([][]string, len(seqs))
+	matches := make([][]byte, len(seqs))
+	for t, seq := range seqs {
+		var insert strings.Builder
+		for i := 0; i < len(seq); i++ {
+			c := seq[i]
+			if c == '.' || unicode.IsLower(rune(c)) {
+				if c != '.' {
+					insert.WriteByte(c)
+				}
+				continue
+			}
+			inserts[t] = append(inserts[t], insert.String())
+			insert.Reset()
+			matches[t] = append(matches[t], c)
+		}
+		inserts[t] = append(inserts[t], insert.String()) //after the last match column
+		if t == 0 {
+			numMatch = len(matches[0])
+		} else if len(matches[t]) != numMatch {
+			return nil, fmt.Errorf("a2m: sequence %s has %d match columns, expected %d", names[t], len(matches[t]), numMatch)
+		}
+	}
+
+	widest := make([]int, numMatch+1)
+	for t := range seqs {
+		for k, insert := range inserts[t] {
+			if len(insert) > widest[k] {
+				widest[k] = len(insert)
+			}
+		}
+	}
+
+	align := &Alignment{Names: names}
+	for k := 0; k <= numMatch; k++ {
+		for w := 0; w < widest[k]; w++ {
+			align.MatchColumns = append(align.MatchColumns, 0)
+		}
+		if k < numMatch {
+			align.MatchColumns = append(align.MatchColumns, 1)
+		}
+	}
+	for t := range seqs {
+		var row strings.Builder
+		for k := 0; k <= numMatch; k++ {
+			row.WriteString(strings.ToUpper(inserts[t][k]))
+			row.WriteString(strings.Repeat("-", widest[k]-len(inserts[t][k])))
+			if k < numMatch {
+				row.WriteByte(matches[t][k])
+			}
+		}
+		align.Rows = append(align.Rows, row.String())
+	}
+	return align, nil
+}
+
+//ReadAlignmentsClustal reads a Clustal (or MUSCLE) alignment. After the header
+//line, each block has one line per sequence with the name, a piece of the
+//aligned string and maybe a residue count; the lines of the same name are
+//joined. The conservation lines under each block start with spaces and are skipped.
+func ReadAlignmentsClustal(file io.Reader) (*Alignment, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() || !(strings.HasPrefix(scanner.Text(), "CLUSTAL") || strings.HasPrefix(scanner.Text(), "MUSCLE")) {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("clustal: missing CLUSTAL header line")
+	}
+
+	align := &Alignment{}
+	rows := make(map[string]*strings.Builder)
+	lineNum := 1
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("clustal line %d: expected name and aligned string", lineNum)
+		}
+		if rows[fields[0]] == nil {
+			rows[fields[0]] = &strings.Builder{}
+			align.Names = append(align.Names, fields[0])
+		}
+		rows[fields[0]].WriteString(fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, name := range align.Names {
+		align.Rows = append(align.Rows, strings.ToUpper(strings.ReplaceAll(rows[name].String(), ".", "-")))
+	}
+	return align, checkRowLengths(align)
+}
+
+//ReadAlignmentsMSF reads a GCG MSF alignment. The header, with a "Name:" line for
+//each sequence, ends at the "//" line. After it, each block line has the name
+//and the aligned string in groups of ten separated by spaces. Gaps may be "."
+//or "~", and the lines of column numbers between blocks are skipped.
+func ReadAlignmentsMSF(file io.Reader) (*Alignment, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	align := &Alignment{}
+	rows := make(map[string]*strings.Builder)
+	inHeader := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inHeader {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "Name:" {
+				rows[fields[1]] = &strings.Builder{}
+				align.Names = append(align.Names, fields[1])
+			}
+			if line == "//" {
+				inHeader = false
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || rows[fields[0]] == nil {
+			continue //blank lines and lines of column numbers
+		}
+		rows[fields[0]].WriteString(strings.Join(fields[1:], ""))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if inHeader {
+		return nil, errors.New("msf: missing \"//\" line at the end of the header")
+	}
+	for _, name := range align.Names {
+		row := strings.NewReplacer(".", "-", "~", "-").Replace(rows[name].String())
+		align.Rows = append(align.Rows, strings.ToUpper(row))
+	}
+	return align, checkRowLengths(align)
+}
+
+//readRawFasta reads the names and the sequences of a FASTA file as they are
+//written, only removing the spaces, so that the case and gaps of an alignment
+//are kept.
+func readRawFasta(file io.Reader) (names, seqs []string, err error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var seq strings.Builder
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, ">") {
+			if len(names) > 0 {
+				seqs = append(seqs, seq.String())
+			}
+			name := strings.Fields(line[1:] + " ")
+			if len(name) == 0 {
+				return nil, nil, errors.New("fasta: record without a name")
+			}
+			names = append(names, name[0])
+			seq.Reset()
+		} else if line != "" && !strings.HasPrefix(line, "#") {
+			if len(names) == 0 {
+				return nil, nil, errors.New("fasta: sequence before the first \">\" line")
+			}
+			seq.WriteString(strings.Join(strings.Fields(line), ""))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(names) > 0 {
+		seqs = append(seqs, seq.String())
+	}
+	return names, seqs, nil
+}
+
+//checkRowLengths returns an error if the alignment has no rows or the rows are
+//not all of the same length.
+func checkRowLengths(align *Alignment) error {
+	if len(align.Rows) == 0 {
+		return errors.New("no sequences found in the alignment")
+	}
+	for t, row := range align.Rows {
+		if len(row) != len(align.Rows[0]) {
+			return fmt.Errorf("sequence %s has length %d, expected %d", align.Names[t], len(row), len(align.Rows[0]))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package profilehmm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//TestReadAlignment reads a small alignment in each format the readers of this
+//file know, by the name of the format, and then with the format detected,
+//unless the file is meant to look like another format.
+func TestReadAlignment(t *testing.T) {
+	tests := []struct {
+		name, format, file string
+		want               *Alignment
+	}{
+		{"pfam", "pfam", "s1/1-4  AC-D\ns2/1-4  ACGD\n",
+			&Alignment{Rows: []string{"AC-D", "ACGD"}}},
+		{"aligned fasta", "fasta", ">s1 first sequence\nAC-D-\n>s2\nAC\nGDE\n",
+			&Alignment{Names: []string{"s1", "s2"}, Rows: []string{"AC-D-", "ACGDE"}}},
+		{"aligned fasta in lower case with dots, read as a2m if detected", "fasta", ">s1\nac-d.\n>s2\nacgde\n",
+			&Alignment{Names: []string{"s1", "s2"}, Rows: []string{"AC-D-", "ACGDE"}}},
+		{"a2m", "a2m", ">s1\nAC.DE\n>s2\nA-kDE\n",
+			&Alignment{Names: []string{"s1", "s2"}, Rows: []string{"AC-DE", "A-KDE"}, MatchColumns: []int{1, 1, 0, 1, 1}}},
+		{"a3m with insertions of uneven widths", "a3m", "#A3M#\n>s1\nACDE\n>s2\nA-kmDE\n>s3\nAqCDE\n",
+			&Alignment{Names: []string{"s1", "s2", "s3"}, Rows: []string{"A-C--DE", "A--KMDE", "AQC--DE"}, MatchColumns: []int{1, 0, 1, 0, 0, 1, 1}}},
+		{"clustal in two blocks", "clustal", "CLUSTAL W (1.83) multiple sequence alignment\n\n" +
+			"s1      AC-DE 4\ns2      ACGDE 5\n        ** **\n\n" +
+			"s1      FG 6\ns2      F- 6\n        *\n",
+			&Alignment{Names: []string{"s1", "s2"}, Rows: []string{"AC-DEFG", "ACGDEF-"}}},
+		{"msf", "msf", "!!AA_MULTIPLE_ALIGNMENT 1.0\n\n test.msf  MSF: 12  Type: P  Check: 1234 ..\n\n" +
+			" Name: s1  Len: 12  Check: 1  Weight: 1.00\n Name: s2  Len: 12  Check: 2  Weight: 1.00\n\n//\n\n" +
+			"       1                       12\ns1     ACDEFGHIKL MN\ns2     AC..FGHIK~ ~n\n",
+			&Alignment{Names: []string{"s1", "s2"}, Rows: []string{"ACDEFGHIKLMN", "AC--FGHIK--N"}}},
+		{"stockholm with RF", "stockholm", "# STOCKHOLM 1.0\n#=GF ID test\ns1 AC.D\ns2 ACgD\n#=GC RF xx.x\n//\n",
+			&Alignment{Names: []string{"s1", "s2"}, Rows: []string{"AC-D", "ACGD"}, ID: "test", MatchColumns: []int{1, 1, 0, 1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formats := []string{test.format, "auto"}
+			if DetectAlignmentFormat([]byte(test.file)) != test.format {
+				formats = formats[:1]
+			}
+			for _, format := range formats {
+				align, err := ReadAlignment(strings.NewReader(test.file), format)
+				if err != nil {
+					t.Fatalf("%s: %v", format, err)
+				}
+				if !reflect.DeepEqual(align, test.want) {
+					t.Errorf("%s: alignment is %+v, want %+v", format, align, test.want)
+				}
+			}
+		})
+	}
+}
+
+//TestReadAlignmentErrors checks that rows of different lengths, A2M rows of
+//different numbers of match columns and missing headers are refused.
+func TestReadAlignmentErrors(t *testing.T) {
+	tests := []struct {
+		name, format, file, wantErr string
+	}{
+		{"fasta rows of different lengths", "fasta", ">s1\nACDE\n>s2\nACD\n", "sequence s2 has length 3, expected 4"},
+		{"fasta without records", "fasta", "", "no sequences found"},
+		{"fasta sequence before a name", "fasta", "ACDE\n>s1\nACDE\n", "before the first"},
+		{"a2m rows of different match columns", "a2m", ">s1\nACDE\n>s2\nACDkk\n", "sequence s2 has 3 match columns, expected 4"},
+		{"clustal without header", "clustal", "s1 ACDE\n", "missing CLUSTAL header"},
+		{"msf without end of header", "msf", " Name: s1  Len: 4\ns1 ACDE\n", "missing \"//\" line"},
+		{"unknown format", "phylip", "", "unknown alignment format"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadAlignment(strings.NewReader(test.file), test.format)
+			if err == nil {
+				t.Fatal("ReadAlignment accepted the file")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error is %q, want it to mention %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+//TestDetectAlignmentFormat checks the format detected from the first lines of
+//each kind of file.
+func TestDetectAlignmentFormat(t *testing.T) {
+	tabular := "query\tsubject" + strings.Repeat("\t1", 10) + "\tACDE\tACDE\n"
+	tests := []struct {
+		name, file, want string
+	}{
+		{"stockholm", "# STOCKHOLM 1.0\ns1 ACDE\n//\n", "stockholm"},
+		{"stockholm after blank lines", "\n\n# STOCKHOLM 1.0\n", "stockholm"},
+		{"clustal", "CLUSTAL O(1.2.4) multiple sequence alignment\n", "clustal"},
+		{"muscle", "MUSCLE (3.8) multiple sequence alignment\n", "clustal"},
+		{"msf header", "!!AA_MULTIPLE_ALIGNMENT 1.0\n", "msf"},
+		{"msf pileup", "PileUp\n", "msf"},
+		{"msf line", " test.msf  MSF: 12  Type: P  Check: 1234 ..\n", "msf"},
+		{"blast program line", "BLASTP 2.12.0+\n\nReference: ...\n", "blast"},
+		{"tblastn program line", "TBLASTN 2.2.31+\n", "blast"},
+		{"blast query line", "Query= sp|P12931|SRC_HUMAN\n", "blast"},
+		{"blast xml", "<?xml version=\"1.0\"?>\n<!DOCTYPE BlastOutput>\n", "blast"},
+		{"blast tabular comments", "# BLASTP 2.12.0+\n# Query: q\n", "blast"},
+		{"blast tabular", tabular, "blast"},
+		{"word that is not a program line", "BLASTP alignment\n", "pfam"},
+		{"aligned fasta", ">s1\nAC-D\n>s2\nACGD\n", "fasta"},
+		{"a2m", ">s1\nAC.DE\n>s2\nA-kDE\n", "a2m"},
+		{"a3m", ">s1\nACDE\n>s2\nA-kmDE\n", "a3m"},
+		{"a3m after a comment line", "#A3M#\n>s1\nACDE\n>s2\nA-kmDE\n", "a3m"},
+		{"a2m after comment lines", "# made by hand\n#\n>s1\nAC.DE\n>s2\nA-kDE\n", "a2m"},
+		{"pfam", "s1/1-4  AC-D\ns2/1-4  ACGD\n", "pfam"},
+		{"empty file", "", "pfam"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectAlignmentFormat([]byte(test.file)); got != test.want {
+				t.Errorf("format is %q, want %q", got, test.want)
+			}
+		})
+	}
+}
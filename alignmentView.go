@@ -0,0 +1,171 @@
+//This file draws the alignment of a sequence to the model for people to read,
+//the way hmmsearch does, instead of the path of states:
+//
+//   SH3    1 aLydyeaeeedeLsfkkGdvieVl 24
+//            +LYDY+A++ D+LSF+KG+ ++++
+//   seq1   1 ALYDYEARTEDDLSFHKGEKFQIL 24
+//
+//The first line is the consensus of the model, the residue each match state
+//emits most, in upper case if it emits it more than half the time, and "." for
+//the columns of insertions. The last line is the sequence: residues of match
+//states in upper case, insertions in lower case and deletions as "-". The line
+//in the middle tells how well they match: the residue if it is the consensus,
+//"+" if the match state emits it more than the null model does, and a space
+//otherwise. The numbers are the first and last match state and residue of each
+//line.
+
+package profilehmm
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//DefaultAlignmentWidth is the number of columns of each block of an AlignmentView.
+const DefaultAlignmentWidth = 60
+
+//AlignmentView is the alignment of a domain to the model. Model, Match and Seq
+//are the three lines; ModelPos and SeqPos give, for each column, the match state
+//and the residue (from 1) of the column, or 0 for an insertion in the model line
+//and a deletion in the sequence line.
+type AlignmentView struct {
+	ModelName string
+	SeqName   string
+	Model     string
+	Match     string
+	Seq       string
+	ModelPos  []int
+	SeqPos    []int
+}
+
+//AlignmentView draws the alignment of a domain found in the sequence (see
+//SearchHit and Domains) from its A2M row.
+func (hmm *ProfileHMM) AlignmentView(seqName string, domain Domain) *AlignmentView {
+	view := &AlignmentView{ModelName: hmm.Name, SeqName: seqName}
+	var model, match, seq strings.Builder
+	k, residue := domain.HMMFrom, domain.SeqFrom
+	for _, r := range domain.Alignment {
+		letter := string(r)
+		switch {
+		case letter == "-": //deletion
+			model.WriteString(hmm.consensusResidue(k))
+			match.WriteByte(' ')
+			seq.WriteByte('-')
+			view.ModelPos = append(view.ModelPos, k)
+			view.SeqPos = append(view.SeqPos, 0)
+			k++
+		case letter == strings.ToLower(letter) && letter != strings.ToUpper(letter): //insertion
+			model.WriteByte('.')
+			match.WriteByte(' ')
+			seq.WriteString(letter)
+			view.ModelPos = append(view.ModelPos, 0)
+			view.SeqPos = append(view.SeqPos, residue)
+			residue++
+		default: //match
+			consensus := hmm.consensusResidue(k)
+			state := "M" + strconv.Itoa(k)
+			switch {
+			case strings.ToUpper(consensus) == letter:
+				match.WriteString(letter)
+			case hmm.Emimap[state][letter] > hmm.Null[letter]:
+				match.WriteByte('+')
+			default:
+				match.WriteByte(' ')
+			}
+			model.WriteString(consensus)
+			seq.WriteString(letter)
+			view.ModelPos = append(view.ModelPos, k)
+			view.SeqPos = append(view.SeqPos, residue)
+			k++
+			residue++
+		}
+	}
+	view.Model, view.Match, view.Seq = model.String(), match.String(), seq.String()
+	return view
+}
+
+//consensusResidue returns the residue match state k emits most, in lower case
+//if it emits it less than half the time. Ties go to the first one in sigma.
+func (hmm *ProfileHMM) consensusResidue(k int) string {
+	row := hmm.Emimap["M"+strconv.Itoa(k)]
+	best := ""
+	for _, letter := range hmm.Alphabet {
+		if best == "" || row[letter] > row[best] {
+			best = letter
+		}
+	}
+	if row[best] < 0.5 {
+		return strings.ToLower(best)
+	}
+	return best
+}
+
+//Write writes the alignment in blocks of width columns (DefaultAlignmentWidth
+//if width is not positive), with a blank line after each block. The names are
+//padded to the same width, and the numbers are the first and last match state or
+//residue of the block, or "-" if the block has none.
+func (view *AlignmentView) Write(w io.Writer, width int) {
+	if width <= 0 {
+		width = DefaultAlignmentWidth
+	}
+	nameWidth := len(view.ModelName)
+	if len(view.SeqName) > nameWidth {
+		nameWidth = len(view.SeqName)
+	}
+	numWidth := len(strconv.Itoa(maxInt(view.ModelPos))) //the widest number of the lines
+	if n := len(strconv.Itoa(maxInt(view.SeqPos))); n > numWidth {
+		numWidth = n
+	}
+
+	for start := 0; start < len(view.Model); start += width {
+		end := start + width
+		if end > len(view.Model) {
+			end = len(view.Model)
+		}
+		modelFrom, modelTo := positionRange(view.ModelPos[start:end])
+		seqFrom, seqTo := positionRange(view.SeqPos[start:end])
+		fmt.Fprintf(w, "  %*s %*s %s %s\n", nameWidth, view.ModelName, numWidth, modelFrom, view.Model[start:end], modelTo)
+		fmt.Fprintf(w, "  %*s %*s %s\n", nameWidth, "", numWidth, "", view.Match[start:end])
+		fmt.Fprintf(w, "  %*s %*s %s %s\n\n", nameWidth, view.SeqName, numWidth, seqFrom, view.Seq[start:end], seqTo)
+	}
+}
+
+//positionRange returns the first and last non zero position, or "-" for both if
+//there is none.
+func positionRange(positions []int) (string, string) {
+	from, to := "-", "-"
+	for _, pos := range positions {
+		if pos == 0 {
+			continue
+		}
+		if from == "-" {
+			from = strconv.Itoa(pos)
+		}
+		to = strconv.Itoa(pos)
+	}
+	return from, to
+}
+
+//maxInt returns the largest number of the slice, or 0 if it is empty.
+func maxInt(numbers []int) int {
+	max := 0
+	for _, n := range numbers {
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+//AlignmentViews draws the alignment of each domain in a path of the string, as
+//returned by Decode or DecodeMode. A global path is one domain from its first to
+//its last match state; the residues before and after it are left out.
+func (hmm *ProfileHMM) AlignmentViews(seqName, path, str string) []*AlignmentView {
+	var views []*AlignmentView
+	for _, domain := range pathDomains(path, str) {
+		views = append(views, hmm.AlignmentView(seqName, domain))
+	}
+	return views
+}
@@ -0,0 +1,105 @@
+package profilehmm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//tinyProfileHMM builds a profile HMM of 3 match states by hand. M1 emits C
+//most, M2 emits R most but less than half the time and M3 always emits G; the
+//insertion states emit like the background.
+func tinyProfileHMM(t *testing.T) *ProfileHMM {
+	t.Helper()
+	states := MakeMapHeader(3)
+	trmap := CreatEmptyMap(states, states)
+	for from, row := range map[string]map[string]float64{
+		"Start": {"I0": 0.1, "M1": 0.8, "D1": 0.1},
+		"I0":    {"I0": 0.5, "M1": 0.5},
+		"M1":    {"M2": 0.9, "I1": 0.1},
+		"D1":    {"M2": 0.5, "D2": 0.5},
+		"I1":    {"I1": 0.5, "M2": 0.5},
+		"M2":    {"M3": 0.7, "D3": 0.2, "I2": 0.1},
+		"D2":    {"M3": 1},
+		"I2":    {"I2": 0.5, "M3": 0.5},
+		"M3":    {"End": 0.8, "I3": 0.2},
+		"D3":    {"End": 1},
+		"I3":    {"I3": 0.5, "End": 0.5},
+	} {
+		for to, pr := range row {
+			trmap[from][to] = pr
+		}
+	}
+	emimap := CreatEmptyMap(states, Amino)
+	emimap["M1"]["C"], emimap["M1"]["W"] = 0.6, 0.4
+	emimap["M2"]["H"], emimap["M2"]["K"], emimap["M2"]["R"] = 0.3, 0.3, 0.4
+	emimap["M3"]["G"] = 1
+	for _, state := range []string{"I0", "I1", "I2", "I3"} {
+		for _, letter := range Amino {
+			emimap[state][letter] = BackgroundProtein[letter]
+		}
+	}
+	if problems := ValidateMaps(Amino, states, trmap, emimap); len(problems) > 0 {
+		t.Fatalf("tiny model is not valid: %v", problems)
+	}
+	hmm, err := NewProfileHMM("tiny", Amino, states, trmap, emimap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hmm
+}
+
+//TestAlignmentView draws a domain with an insertion and a deletion on the tiny
+//model, and writes it in blocks of different widths.
+func TestAlignmentView(t *testing.T) {
+	hmm := tinyProfileHMM(t)
+	domain := Domain{SeqFrom: 4, SeqTo: 7, HMMFrom: 1, HMMTo: 3, Alignment: "Wkq-G"}
+	view := hmm.AlignmentView("seq1", domain)
+	if view.Model != "C..rG" || view.Match != "+   G" || view.Seq != "Wkq-G" {
+		t.Errorf("lines are %q %q %q, want \"C..rG\" \"+   G\" \"Wkq-G\"", view.Model, view.Match, view.Seq)
+	}
+	if !reflect.DeepEqual(view.ModelPos, []int{1, 0, 0, 2, 3}) || !reflect.DeepEqual(view.SeqPos, []int{4, 5, 6, 0, 7}) {
+		t.Errorf("positions are %v and %v", view.ModelPos, view.SeqPos)
+	}
+
+	tests := []struct {
+		width int
+		want  string
+	}{
+		{0, "  tiny 1 C..rG 3\n" +
+			"         +   G\n" +
+			"  seq1 4 Wkq-G 7\n\n"},
+		{2, "  tiny 1 C. 1\n" +
+			"         + \n" +
+			"  seq1 4 Wk 5\n\n" +
+			"  tiny 2 .r 2\n" +
+			"           \n" +
+			"  seq1 6 q- 6\n\n" +
+			"  tiny 3 G 3\n" +
+			"         G\n" +
+			"  seq1 7 G 7\n\n"},
+		{3, "  tiny 1 C.. 1\n" +
+			"         +  \n" +
+			"  seq1 4 Wkq 6\n\n" +
+			"  tiny 2 rG 3\n" +
+			"          G\n" +
+			"  seq1 7 -G 7\n\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		view.Write(&out, test.width)
+		if out.String() != test.want {
+			t.Errorf("width %d:\n%s\nwant:\n%s", test.width, out.String(), test.want)
+		}
+	}
+
+	//a block of only an insertion has no match state, one of a deletion no residue.
+	var out bytes.Buffer
+	view.Write(&out, 1)
+	for _, line := range []string{"  tiny - . -\n", "  seq1 - - -\n"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("width 1 has no line %q:\n%s", line, out.String())
+		}
+	}
+}
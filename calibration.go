@@ -0,0 +1,248 @@
+//This file calibrates the scores of a profile HMM, so that a score can be turned
+//into a P-value and an E-value. A log odds score alone can not be compared
+//between families: a long model like a zinc finger array and a short one like
+//SH3 score random sequences very differently. Calibrate scores random sequences
+//emitted by the null model, and fits the distribution of their scores: a Gumbel
+//(extreme value) distribution for the Viterbi scores, which are the maximum over
+//paths, and an exponential tail for the Forward scores, which are a sum over
+//paths. The parameters are kept in the model and saved with it.
+
+package profilehmm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+//Defaults of Calibrate: the number of random sequences, their length outside
+//global mode, and the part of the highest Forward scores the exponential tail is
+//fitted to (the values of HMMER). MinCalibrationSeqs is the fewest scores the
+//tail can be fitted to, so that it has at least 2 of them.
+const (
+	DefaultCalibrationSeqs   = 200
+	DefaultCalibrationLength = 100
+	CalibrationTailMass      = 0.04
+	MinCalibrationSeqs       = int(2 / CalibrationTailMass)
+)
+
+//Calibration has the fitted score distributions of a model in an align mode,
+//single or multi-domain, in bits; the scores of the other modes are distributed
+//differently. Viterbi scores follow a Gumbel distribution of location ViterbiMu
+//and slope ViterbiLambda. The highest Forward scores follow an exponential tail
+//exp(-ForwardLambda (x - ForwardTau)). NumSeqs and SeqLength tell how many
+//random sequences of which length were scored. The STATS lines of HMMER3 files
+//are fitted to HMMER's scores, not ours, so they are kept in HMMERStats instead.
+type Calibration struct {
+	Mode          AlignMode `json:"mode,omitempty"`
+	MultiDomain   bool      `json:"multi_domain,omitempty"`
+	ViterbiMu     float64   `json:"viterbi_mu"`
+	ViterbiLambda float64   `json:"viterbi_lambda"`
+	ForwardTau    float64   `json:"forward_tau"`
+	ForwardLambda float64   `json:"forward_lambda"`
+	NumSeqs       int       `json:"num_seqs,omitempty"`
+	SeqLength     int       `json:"seq_length,omitempty"`
+}
+
+//Calibrate scores numSeqs random sequences of the given length in the align
+//mode, with a single or multi-domain model (see configure), with residues drawn
+//from the null model (the random numbers come from the seed), and fits the
+//Viterbi and Forward scores. A length of 0 uses the length of the model in
+//global mode, which scores best sequences about as long as the domain, and
+//DefaultCalibrationLength in the other modes, whose flanks make the scores
+//depend little on the length.
+//The scores are log odds against the null model of the mode in bits, without
+//the bias correction. It keeps the result in hmm.Calibration and returns it.
+//It needs at least MinCalibrationSeqs sequences, and as many that the model can
+//emit.
+func (hmm *ProfileHMM) Calibrate(mode AlignMode, multi bool, numSeqs, length int, seed int64) (*Calibration, error) {
+	if numSeqs < MinCalibrationSeqs {
+		return nil, fmt.Errorf("calibrate: %d random sequences are too few to fit a tail, use at least %d", numSeqs, MinCalibrationSeqs)
+	}
+	mode = mode.normal()
+	multi = multi && mode != Global
+	if length <= 0 && mode == Global {
+		length = hmm.Length
+	} else if length <= 0 {
+		length = DefaultCalibrationLength
+	}
+	tr, emi, err := hmm.configure(mode, multi, length)
+	if err != nil {
+		return nil, fmt.Errorf("calibrate: %w", err)
+	}
+
+	//cumulative null rates to draw residues from.
+	cumulative := make([]float64, len(hmm.Alphabet))
+	total := 0.0
+	for a, letter := range hmm.Alphabet {
+		total += hmm.Null[letter]
+		cumulative[a] = total
+	}
+	if total <= 0 {
+		return nil, errors.New("calibrate: the null model has no emissions")
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	startpoint := hmm.modeStartpoint(mode)
+	viterbiScores := make([]float64, 0, numSeqs)
+	forwardScores := make([]float64, 0, numSeqs)
+	seq := make([]int, length)
+	for n := 0; n < numSeqs; n++ {
+		for i := range seq {
+			seq[i] = sort.SearchFloat64s(cumulative, random.Float64()*total)
+		}
+		nullLogPr := hmm.nullScore(mode, seq)
+		_, viterbiLogPr, err := viterbiPath(startpoint, seq, tr, emi)
+		if err != nil { //some residue can not be emitted: the score is -Inf and tells nothing.
+			continue
+		}
+		forwardLogPr := ForwardIndexed(startpoint, seq, tr, emi)
+		viterbiScores = append(viterbiScores, (viterbiLogPr-nullLogPr)/math.Ln2)
+		forwardScores = append(forwardScores, (forwardLogPr-nullLogPr)/math.Ln2)
+	}
+	if len(viterbiScores) < numSeqs/2 || len(viterbiScores) < MinCalibrationSeqs {
+		return nil, fmt.Errorf("calibrate: only %d of %d random sequences can be emitted by the model, at least %d are needed", len(viterbiScores), numSeqs, MinCalibrationSeqs)
+	}
+
+	mu, lambda, err := FitGumbel(viterbiScores)
+	if err != nil {
+		return nil, fmt.Errorf("calibrate: viterbi scores: %w", err)
+	}
+	tau, tailLambda, err := FitExponentialTail(forwardScores, CalibrationTailMass)
+	if err != nil {
+		return nil, fmt.Errorf("calibrate: forward scores: %w", err)
+	}
+	hmm.Calibration = &Calibration{
+		Mode:          mode,
+		MultiDomain:   multi,
+		ViterbiMu:     mu,
+		ViterbiLambda: lambda,
+		ForwardTau:    tau,
+		ForwardLambda: tailLambda,
+		NumSeqs:       numSeqs,
+		SeqLength:     length,
+	}
+	return hmm.Calibration, nil
+}
+
+//check returns an error if the parameters can not be those of a fit.
+func (c *Calibration) check() error {
+	for _, value := range []float64{c.ViterbiMu, c.ViterbiLambda, c.ForwardTau, c.ForwardLambda} {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("calibration has a value %g", value)
+		}
+	}
+	if c.ViterbiLambda <= 0 || c.ForwardLambda <= 0 {
+		return fmt.Errorf("calibration lambdas need to be positive, got %g and %g", c.ViterbiLambda, c.ForwardLambda)
+	}
+	return nil
+}
+
+//fits tells if the calibration is for scores of the mode and kind of model.
+func (c *Calibration) fits(mode AlignMode, multi bool) bool {
+	mode = mode.normal()
+	return c.Mode.normal() == mode && c.MultiDomain == (multi && mode != Global)
+}
+
+//ViterbiPValue returns the probability that a random sequence has a Viterbi
+//score of at least bits: 1 - exp(-exp(-lambda (bits - mu))).
+func (c *Calibration) ViterbiPValue(bits float64) float64 {
+	return -math.Expm1(-math.Exp(-c.ViterbiLambda * (bits - c.ViterbiMu)))
+}
+
+//ForwardPValue returns the probability that a random sequence has a Forward
+//score of at least bits, from the exponential tail; it is at most 1.
+func (c *Calibration) ForwardPValue(bits float64) float64 {
+	return math.Min(1, math.Exp(-c.ForwardLambda*(bits-c.ForwardTau)))
+}
+
+//EValue is the number of sequences expected to score as well as the P-value
+//by chance, in a database of dbSize sequences.
+func EValue(pValue float64, dbSize int) float64 {
+	return pValue * float64(dbSize)
+}
+
+//FitGumbel returns the maximum likelihood location mu and slope lambda of a
+//Gumbel distribution fitted to the samples. Lambda is the root of
+//1/lambda - mean(x) + sum(x exp(-lambda x)) / sum(exp(-lambda x)), which only
+//decreases with lambda, so it is found by bisection; then
+//mu = -ln(mean(exp(-lambda x))) / lambda.
+func FitGumbel(samples []float64) (mu, lambda float64, err error) {
+	if len(samples) < 2 {
+		return 0, 0, errors.New("need at least 2 samples to fit a Gumbel distribution")
+	}
+	//shift the samples to a mean of 0, so that exp(-lambda x) does not overflow.
+	mean := 0.0
+	for _, x := range samples {
+		mean += x / float64(len(samples))
+	}
+	shifted := make([]float64, len(samples))
+	spread := 0.0
+	for i, x := range samples {
+		shifted[i] = x - mean
+		spread = math.Max(spread, math.Abs(shifted[i]))
+	}
+	if spread == 0 {
+		return 0, 0, errors.New("all the samples are the same")
+	}
+
+	//weighted is the mean of exp(-lambda x) and of x exp(-lambda x).
+	weighted := func(lambda float64) (sumExp, sumXExp float64) {
+		for _, x := range shifted {
+			e := math.Exp(-lambda * x)
+			sumExp += e
+			sumXExp += x * e
+		}
+		return sumExp / float64(len(shifted)), sumXExp / float64(len(shifted))
+	}
+	slope := func(lambda float64) float64 {
+		sumExp, sumXExp := weighted(lambda)
+		return 1/lambda + sumXExp/sumExp
+	}
+	low, high := 1e-6/spread, 1/spread
+	for slope(high) > 0 {
+		low = high
+		high *= 2
+		if high > 1e6 {
+			return 0, 0, errors.New("the Gumbel fit does not converge")
+		}
+	}
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if slope(mid) > 0 {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	lambda = (low + high) / 2
+	sumExp, _ := weighted(lambda)
+	mu = mean - math.Log(sumExp)/lambda
+	return mu, lambda, nil
+}
+
+//FitExponentialTail fits an exponential to the highest tailMass part of the
+//samples. Lambda is one over the mean of how much the tail samples exceed the
+//score where the tail starts, and tau is placed so that exp(-lambda (x - tau))
+//is tailMass where the tail starts.
+func FitExponentialTail(samples []float64, tailMass float64) (tau, lambda float64, err error) {
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	numTail := int(math.Ceil(tailMass * float64(len(sorted))))
+	if numTail < 2 || numTail >= len(sorted) {
+		return 0, 0, fmt.Errorf("can not fit the top %g of %d samples", tailMass, len(sorted))
+	}
+	threshold := sorted[len(sorted)-numTail-1]
+	excess := 0.0
+	for _, x := range sorted[len(sorted)-numTail:] {
+		excess += (x - threshold) / float64(numTail)
+	}
+	if excess <= 0 {
+		return 0, 0, errors.New("the tail samples are all the same")
+	}
+	lambda = 1 / excess
+	tau = threshold + math.Log(tailMass)/lambda
+	return tau, lambda, nil
+}
@@ -0,0 +1,73 @@
+package profilehmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+//TestFitGumbel fits samples drawn from Gumbel distributions of known location
+//and slope, by inverting the distribution function exp(-exp(-lambda (x - mu))).
+func TestFitGumbel(t *testing.T) {
+	for _, want := range []struct{ mu, lambda float64 }{{-5, 0.7}, {0, 1}, {12, 0.25}} {
+		random := rand.New(rand.NewSource(1))
+		samples := make([]float64, 20000)
+		for i := range samples {
+			samples[i] = want.mu - math.Log(-math.Log(random.Float64()))/want.lambda
+		}
+		mu, lambda, err := FitGumbel(samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(lambda-want.lambda) > 0.03*want.lambda || math.Abs(mu-want.mu) > 0.05/want.lambda {
+			t.Errorf("fit of mu %g lambda %g gives mu %g lambda %g", want.mu, want.lambda, mu, lambda)
+		}
+	}
+
+	if _, _, err := FitGumbel([]float64{1}); err == nil {
+		t.Error("no error for 1 sample")
+	}
+	if _, _, err := FitGumbel([]float64{2, 2, 2}); err == nil {
+		t.Error("no error for samples that are all the same")
+	}
+}
+
+//TestFitExponentialTail fits samples drawn from an exponential distribution
+//that starts at tau, exp(-lambda (x - tau)) above it, so that its tail is the
+//same exponential whatever part of it is fitted.
+func TestFitExponentialTail(t *testing.T) {
+	for _, want := range []struct{ tau, lambda float64 }{{-3, 0.7}, {0, 1}, {8, 0.3}} {
+		random := rand.New(rand.NewSource(1))
+		samples := make([]float64, 50000)
+		for i := range samples {
+			samples[i] = want.tau - math.Log(1-random.Float64())/want.lambda
+		}
+		tau, lambda, err := FitExponentialTail(samples, CalibrationTailMass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(lambda-want.lambda) > 0.1*want.lambda || math.Abs(tau-want.tau) > 0.2/want.lambda {
+			t.Errorf("fit of tau %g lambda %g gives tau %g lambda %g", want.tau, want.lambda, tau, lambda)
+		}
+	}
+
+	if _, _, err := FitExponentialTail([]float64{1, 2, 3}, CalibrationTailMass); err == nil {
+		t.Error("no error for a tail of 1 sample")
+	}
+}
+
+//TestCalibrateNumSeqs checks that Calibrate needs MinCalibrationSeqs random
+//sequences, enough for a tail of 2 scores.
+func TestCalibrateNumSeqs(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	if _, err := hmm.Calibrate(Local, true, MinCalibrationSeqs-1, 0, 1); err == nil {
+		t.Errorf("no error for %d random sequences", MinCalibrationSeqs-1)
+	}
+	c, err := hmm.Calibrate(Local, true, MinCalibrationSeqs, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.check(); err != nil {
+		t.Error(err)
+	}
+}
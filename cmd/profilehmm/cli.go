@@ -0,0 +1,883 @@
+//This file contains the non-interactive command line interface. Each subcommand
+//does the same job as one option of the menu in menu.go, but takes all its input
+//from flags, so that it can be run from shell scripts and Makefiles:
+//1. build: build profile HMM given alignments.
+//2. score: the log likelihood of sequences belonging to the domain family.
+//3. align: the most probable path aligning sequences to the HMM.
+//4. emit: generate fictional sequences with the HMM.
+//5. posterior: the probability of each state emitting each residue.
+//6. train: improve the HMM with unaligned sequences.
+//7. convert: write the HMM in another file format.
+//8. view: print the HMM as matrices rounded to 4 decimals.
+//9. validate: check the HMM files for problems.
+//10. search: the sequences that hit the HMM, most significant first.
+//11. calibrate: fit the scores of random sequences, for the E-values of search.
+//12. summary: the consensus, information content and expected length of the HMM.
+//13. logo: draw the HMM as a sequence logo in an SVG file.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	profilehmm "github.com/JiayiShou/Protein-Domain-Finding-with-Hidden-Markov-Model"
+)
+
+//Usage is printed when the program is run without a subcommand or with help.
+const Usage = `Profile Hidden Markov Model for Protein Domains
+
+Usage:
+  profilehmm <command> [flags]
+
+Commands:
+  build      build the transition and emission maps from an alignment file
+  score      log likelihood of sequences against the domain family and null model
+  align      most probable path of sequences through the profile HMM
+  emit       generate fictional domain sequences from the profile HMM
+  posterior  per residue probability of the match and insert states
+  train      re-estimate the profile HMM from unaligned FASTA sequences
+  convert    write the profile HMM as map files, a JSON model or in HMMER3 format
+  view       print the transition and emission matrices rounded to 4 decimals
+  validate   check the model files and list the problems found
+  search     report the sequences that hit the model, with bit scores and E-values
+  calibrate  fit the score distributions of random sequences for the E-values
+  summary    consensus sequence, relative entropy per match state and expected length
+  logo       draw the match emissions and the gaps of the profile HMM as an SVG logo
+  menu       interactive menu (reads answers from stdin)
+  help       show this message
+
+Run "profilehmm <command> -h" for the flags of each command.
+`
+
+//RunCommand takes the command line arguments (without the program name), and
+//runs the subcommand named by the first one.
+func RunCommand(args []string) error {
+	switch args[0] {
+	case "build":
+		return RunBuild(args[1:])
+	case "score":
+		return RunScore(args[1:])
+	case "align":
+		return RunAlign(args[1:])
+	case "emit":
+		return RunEmit(args[1:])
+	case "posterior":
+		return RunPosterior(args[1:])
+	case "train":
+		return RunTrain(args[1:])
+	case "convert":
+		return RunConvert(args[1:])
+	case "view":
+		return RunView(args[1:])
+	case "validate":
+		return RunValidate(args[1:])
+	case "search":
+		return RunSearch(args[1:])
+	case "calibrate":
+		return RunCalibrate(args[1:])
+	case "summary":
+		return RunSummary(args[1:])
+	case "logo":
+		return RunLogo(args[1:])
+	case "menu":
+		Menu()
+		return nil
+	case "help", "-h", "-help", "--help":
+		fmt.Print(Usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q, run \"profilehmm help\" for usage", args[0])
+}
+
+//RunBuild builds the profile HMM from an alignment file and writes the transition
+//and emission maps. By default they are named after the domain like Option1 does.
+func RunBuild(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	alignFile := fs.String("align", "", "alignment file (required)")
+	format := fs.String("format", "auto", "format of the alignment file: pfam (P), blast (B), stockholm (S), fasta, a2m, a3m, clustal, msf, or auto to detect it")
+	domain := fs.String("domain", "", "code of the domain family, used to name the output files (default the #=GF ID of a Stockholm file)")
+	useRF := fs.Bool("rf", false, "use the match columns marked by the file (#=GC RF of Stockholm, upper case of A2M/A3M) instead of -theta")
+	theta := fs.Float64("theta", profilehmm.DefaultTheta, "fraction of gaps above which a column is an insertion column")
+	pseudoCount := fs.Float64("pseudo", profilehmm.DefaultPseudoCount, "pseudocount added to transitions and emissions, 0 for none")
+	trOut := fs.String("tr", "", "output file of the transition map (default <domain>TrMap.txt)")
+	emiOut := fs.String("emi", "", "output file of the emission map (default <domain>EmiMap.txt)")
+	hmmOut := fs.String("hmm", "", "also write the model into this file in HMMER3 format")
+	modelOut := fs.String("model", "", "also write the model and how it was built into this JSON file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *alignFile == "" {
+		return errors.New("build: -align is required")
+	}
+	align, err := ReadAlignmentFile(*format, *alignFile)
+	if err != nil {
+		return err
+	}
+	if len(align.Rows) == 0 {
+		return fmt.Errorf("build: no alignments found in %s", *alignFile)
+	}
+	if *domain == "" {
+		*domain = align.ID
+	}
+	if *trOut == "" || *emiOut == "" {
+		if *domain == "" {
+			return errors.New("build: -domain is required unless both -tr and -emi are given")
+		}
+		if *trOut == "" {
+			*trOut = *domain + "TrMap.txt"
+		}
+		if *emiOut == "" {
+			*emiOut = *domain + "EmiMap.txt"
+		}
+	}
+
+	var hmm *profilehmm.ProfileHMM
+	if *useRF {
+		if align.MatchColumns == nil {
+			return fmt.Errorf("build: %s does not mark its match columns (#=GC RF or A2M/A3M case)", *alignFile)
+		}
+		hmm, err = profilehmm.BuildProfileHMMWithColumns(*domain, align.MatchColumns, *pseudoCount, profilehmm.Amino, align.Rows)
+	} else {
+		hmm, err = profilehmm.BuildProfileHMM(*domain, *theta, *pseudoCount, profilehmm.Amino, align.Rows)
+	}
+	if err != nil {
+		return err
+	}
+	hmm.Source = filepath.Base(*alignFile)
+	if err := hmm.Save(*trOut, *emiOut); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Emission matrix of ProfileHMM produced:", *emiOut)
+	fmt.Fprintln(os.Stderr, "Transition matrix of ProfileHMM produced:", *trOut)
+	if *hmmOut != "" {
+		if err := saveHMMER3(hmm, *hmmOut); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "HMMER3 model of ProfileHMM produced:", *hmmOut)
+	}
+	if *modelOut != "" {
+		if err := hmm.SaveJSON(*modelOut); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "JSON model of ProfileHMM produced:", *modelOut)
+	}
+	return nil
+}
+
+//RunConvert reads a profile HMM from map files, a JSON model or a HMMER3 file
+//and writes it out in the formats asked for, for example to score our models
+//with hmmsearch, or to use a Pfam HMM with the other commands.
+func RunConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	model := modelFlags(fs)
+	trOut := fs.String("outtr", "", "output file of the transition map")
+	emiOut := fs.String("outemi", "", "output file of the emission map")
+	hmmOut := fs.String("outhmm", "", "output file in HMMER3 format")
+	modelOut := fs.String("outmodel", "", "output JSON model file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*trOut == "") != (*emiOut == "") {
+		return errors.New("convert: give both -outtr and -outemi")
+	}
+	if *trOut == "" && *hmmOut == "" && *modelOut == "" {
+		return errors.New("convert: give -outtr and -outemi, -outhmm or -outmodel")
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+	if *trOut != "" {
+		if err := hmm.Save(*trOut, *emiOut); err != nil {
+			return err
+		}
+	}
+	if *hmmOut != "" {
+		if err := saveHMMER3(hmm, *hmmOut); err != nil {
+			return err
+		}
+	}
+	if *modelOut != "" {
+		return hmm.SaveJSON(*modelOut)
+	}
+	return nil
+}
+
+//RunScore prints, for each input sequence, its name, its length and the log
+//likelihood of the domain family against the null model, one tab separated row
+//per sequence. With -mode local or glocal, the domain may be anywhere in the
+//sequence (see profilehmm.AlignMode).
+func RunScore(args []string) error {
+	fs := flag.NewFlagSet("score", flag.ContinueOnError)
+	model := modelFlags(fs)
+	seq, in := sequenceFlags(fs)
+	modeName := modeFlag(fs, profilehmm.Global)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mode, err := profilehmm.ParseAlignMode(*modeName)
+	if err != nil {
+		return err
+	}
+	names, seqs, err := ReadSequenceInput(*seq, *in)
+	if err != nil {
+		return err
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, str := range seqs {
+		likelihood, err := hmm.ScoreMode(mode, str)
+		if err != nil {
+			failed = reportFailure(names[i], err, failed)
+			continue
+		}
+		fmt.Printf("%s\t%d\t%g\n", names[i], len(str), likelihood)
+	}
+	return failures("score", failed, len(seqs))
+}
+
+//RunAlign prints, for each input sequence, its name, the most probable path
+//through the profile HMM and the probability of that path, one tab separated row
+//per sequence.
+//With -method mea, it prints the maximum expected accuracy path and its expected
+//number of correctly aligned residues instead. With -mode local or glocal, the
+//residues around the domain are in the N and C states of the path.
+func RunAlign(args []string) error {
+	fs := flag.NewFlagSet("align", flag.ContinueOnError)
+	model := modelFlags(fs)
+	seq, in := sequenceFlags(fs)
+	method := fs.String("method", "viterbi", "decoding method: viterbi or mea (maximum expected accuracy)")
+	modeName := modeFlag(fs, profilehmm.Global)
+	format := fs.String("format", "path", "output format: path (the states, one sequence per line) or alignment (the residues under the model consensus)")
+	width := fs.Int("width", profilehmm.DefaultAlignmentWidth, "columns of each line of the alignment format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mode, err := profilehmm.ParseAlignMode(*modeName)
+	if err != nil {
+		return err
+	}
+	if *method != "viterbi" && *method != "mea" {
+		return fmt.Errorf("align: unknown method %q", *method)
+	}
+	if *format != "path" && *format != "alignment" {
+		return fmt.Errorf("align: unknown format %q", *format)
+	}
+	names, seqs, err := ReadSequenceInput(*seq, *in)
+	if err != nil {
+		return err
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, str := range seqs {
+		var path string
+		var prPath float64
+		if *method == "mea" {
+			path, prPath, err = hmm.DecodeMEAMode(mode, str)
+		} else {
+			path, prPath, err = hmm.DecodeMode(mode, str)
+		}
+		if err != nil {
+			failed = reportFailure(names[i], err, failed)
+			continue
+		}
+		if *format == "path" {
+			fmt.Printf("%s\t%s\t%g\n", names[i], path, prPath)
+			continue
+		}
+		fmt.Printf(">> %s  path probability: %g\n\n", names[i], prPath)
+		views := hmm.AlignmentViews(names[i], path, str)
+		if len(views) == 0 {
+			fmt.Print("   [the path goes through no match state]\n\n")
+		}
+		for _, view := range views {
+			view.Write(os.Stdout, *width)
+		}
+	}
+	return failures("align", failed, len(seqs))
+}
+
+//RunPosterior prints, for each residue of each input sequence, the match and
+//insert states that emitted it with a posterior probability of at least -min.
+//Each row has the sequence, the position (from 1), the residue, the state and
+//the probability, tab separated, most probable state first.
+func RunPosterior(args []string) error {
+	fs := flag.NewFlagSet("posterior", flag.ContinueOnError)
+	model := modelFlags(fs)
+	seq, in := sequenceFlags(fs)
+	minPr := fs.Float64("min", 0.01, "smallest posterior probability to report")
+	modeName := modeFlag(fs, profilehmm.Global)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mode, err := profilehmm.ParseAlignMode(*modeName)
+	if err != nil {
+		return err
+	}
+	names, seqs, err := ReadSequenceInput(*seq, *in)
+	if err != nil {
+		return err
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i, str := range seqs {
+		post, err := hmm.PosteriorMode(mode, str)
+		if err != nil {
+			failed = reportFailure(names[i], err, failed)
+			continue
+		}
+		for r := range str {
+			order := make([]int, 0, len(post.States))
+			for v, pr := range post.Prob[r] {
+				if pr >= *minPr && pr > 0 {
+					order = append(order, v)
+				}
+			}
+			sort.Slice(order, func(a, b int) bool { return post.Prob[r][order[a]] > post.Prob[r][order[b]] })
+			for _, v := range order {
+				fmt.Printf("%s\t%d\t%s\t%s\t%.4f\n", names[i], r+1, str[r:r+1], post.States[v], post.Prob[r][v])
+			}
+		}
+	}
+	return failures("posterior", failed, len(seqs))
+}
+
+//RunSearch scores every input sequence like hmmsearch and prints the hits that
+//pass the thresholds, most significant first, as a table (-format text), tab
+//separated values (tsv) or JSON (json). See profilehmm.SearchHit for the scores.
+//By default the domains are looked for inside the sequences (-mode local), and
+//each sequence may have many of them (-multi); each domain is reported with its
+//own score and alignment, and marked if it passes -domE and -domT.
+func RunSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	model := modelFlags(fs)
+	seq, in := sequenceFlags(fs)
+	format := fs.String("format", "text", "output format: text, tsv or json")
+	maxEValue := fs.Float64("E", profilehmm.DefaultSearchOptions.MaxEValue, "report hits with an E-value up to this (0 for no limit)")
+	minScore := fs.Float64("T", math.Inf(-1), "report hits with a score (bits) of at least this")
+	domEValue := fs.Float64("domE", profilehmm.DefaultSearchOptions.IncDomEValue, "include domains with an E-value up to this (0 for no limit)")
+	domScore := fs.Float64("domT", math.Inf(-1), "include domains with a score (bits) of at least this")
+	dbSize := fs.Int("Z", 0, "number of sequences the E-values are computed for (default: the number searched)")
+	modeName := modeFlag(fs, profilehmm.DefaultSearchOptions.Mode)
+	multi := fs.Bool("multi", profilehmm.DefaultSearchOptions.MultiDomain, "find many copies of the domain in each sequence (local and glocal mode)")
+	width := fs.Int("width", profilehmm.DefaultAlignmentWidth, "columns of each line of the domain alignments (text format)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mode, err := profilehmm.ParseAlignMode(*modeName)
+	if err != nil {
+		return err
+	}
+	if *format != "text" && *format != "tsv" && *format != "json" {
+		return fmt.Errorf("search: unknown format %q", *format)
+	}
+	names, seqs, err := ReadSequenceInput(*seq, *in)
+	if err != nil {
+		return err
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+
+	opts := profilehmm.SearchOptions{
+		Mode:         mode,
+		MultiDomain:  *multi,
+		MaxEValue:    *maxEValue,
+		MinScore:     *minScore,
+		IncDomEValue: *domEValue,
+		IncDomScore:  *domScore,
+		DBSize:       *dbSize,
+	}
+	if hmm.HMMERStats != nil && hmm.Calibration == nil {
+		fmt.Fprintln(os.Stderr, "Note: the STATS of the HMMER3 model only fit HMMER's scores and are not used; run calibrate for calibrated E-values")
+	}
+	hits, failed := hmm.Search(names, seqs, opts)
+	for _, err := range failed {
+		fmt.Fprintln(os.Stderr, "skipped", err)
+	}
+	switch *format {
+	case "tsv":
+		profilehmm.WriteHitsTSV(os.Stdout, hits)
+	case "json":
+		if err := profilehmm.WriteHitsJSON(os.Stdout, hmm, len(seqs), opts, hits); err != nil {
+			return err
+		}
+	default:
+		profilehmm.WriteHitsText(os.Stdout, hmm, len(seqs), opts, hits, *width)
+	}
+	return failures("search", len(failed), len(seqs))
+}
+
+//RunCalibrate fits the score distributions of the model on random sequences
+//(see profilehmm.Calibrate), prints the parameters, and writes the calibrated
+//model to a JSON model file; map files and HMMER3 files can not keep them.
+func RunCalibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ContinueOnError)
+	model := modelFlags(fs)
+	numSeqs := fs.Int("n", profilehmm.DefaultCalibrationSeqs, fmt.Sprintf("number of random sequences to score (at least %d, for a tail of %g%% of the scores)", profilehmm.MinCalibrationSeqs, 100*profilehmm.CalibrationTailMass))
+	length := fs.Int("L", 0, "length of the random sequences (default: the length of the model in global mode, 100 otherwise)")
+	seed := fs.Int64("seed", 1, "random seed of the sequences")
+	modelOut := fs.String("outmodel", "", "output JSON model file (required)")
+	modeName := modeFlag(fs, profilehmm.Local)
+	multi := fs.Bool("multi", true, "calibrate the multi-domain model, as search uses by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mode, err := profilehmm.ParseAlignMode(*modeName)
+	if err != nil {
+		return err
+	}
+	if *modelOut == "" {
+		return errors.New("calibrate: give -outmodel to keep the calibration")
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+	c, err := hmm.Calibrate(mode, *multi, *numSeqs, *length, *seed)
+	if err != nil {
+		return err
+	}
+	kind := "single domain"
+	if c.MultiDomain {
+		kind = "multi-domain"
+	}
+	fmt.Printf("%d random sequences of length %d in %s mode, %s\n", c.NumSeqs, c.SeqLength, c.Mode, kind)
+	fmt.Printf("viterbi\tmu %.4f\tlambda %.4f\n", c.ViterbiMu, c.ViterbiLambda)
+	fmt.Printf("forward\ttau %.4f\tlambda %.4f\n", c.ForwardTau, c.ForwardLambda)
+	return hmm.SaveJSON(*modelOut)
+}
+
+//RunEmit prints the given number of fictional domain sequences, one per line.
+func RunEmit(args []string) error {
+	fs := flag.NewFlagSet("emit", flag.ContinueOnError)
+	model := modelFlags(fs)
+	numSeq := fs.Int("n", 1, "number of sequences to generate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *numSeq < 0 {
+		return errors.New("emit: -n can not be negative")
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+
+	for n := 0; n < *numSeq; n++ {
+		_, seq := hmm.Sample()
+		fmt.Println(seq)
+	}
+	return nil
+}
+
+//RunTrain trains a profile HMM on the unaligned sequences of a FASTA file and
+//writes the trained transition and emission maps. It starts from the model in
+//-tr and -emi, or from a flat model with -length match states. The log
+//likelihood of each iteration is printed as a tab separated row, followed by the
+//number of skipped sequences and, for Viterbi training, of changed paths.
+func RunTrain(args []string) error {
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	model := modelFlags(fs)
+	length := fs.Int("length", 0, "start from a flat model with this many match states instead of -tr and -emi (or -hmm)")
+	in := fs.String("in", "", "FASTA file of unaligned training sequences, - for stdin (required)")
+	method := fs.String("method", "baumwelch", "training method: baumwelch or viterbi")
+	pseudoCount := fs.Float64("pseudo", profilehmm.DefaultPseudoCount, "pseudocount added to transitions and emissions")
+	maxIter := fs.Int("maxiter", 100, "largest number of iterations")
+	tolerance := fs.Float64("tol", 0.01, "stop Baum-Welch when the log likelihood changes by less than this")
+	seed := fs.Int64("seed", 1, "random seed of the flat model")
+	domain := fs.String("domain", "", "code of the domain family, used to name the output files")
+	trOut := fs.String("outtr", "", "output file of the trained transition map (default <domain>TrMap.txt)")
+	emiOut := fs.String("outemi", "", "output file of the trained emission map (default <domain>EmiMap.txt)")
+	hmmOut := fs.String("outhmm", "", "also write the trained model into this file in HMMER3 format")
+	modelOut := fs.String("outmodel", "", "also write the trained model into this JSON file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("train: -in is required")
+	}
+	if *trOut == "" || *emiOut == "" {
+		if *domain == "" {
+			return errors.New("train: -domain is required unless both -outtr and -outemi are given")
+		}
+		if *trOut == "" {
+			*trOut = *domain + "TrMap.txt"
+		}
+		if *emiOut == "" {
+			*emiOut = *domain + "EmiMap.txt"
+		}
+	}
+
+	var hmm *profilehmm.ProfileHMM
+	var err error
+	if *length > 0 {
+		hmm, err = profilehmm.FlatProfileHMM(*domain, *length, profilehmm.Amino, *seed)
+	} else if model.given() {
+		hmm, err = model.load()
+	} else {
+		return errors.New("train: give either -length, both -tr and -emi, or -hmm")
+	}
+	if err != nil {
+		return err
+	}
+	_, seqs, err := ReadFastaFile(*in)
+	if err != nil {
+		return err
+	}
+	hmm.Source = filepath.Base(*in)
+
+	var steps []profilehmm.TrainingStep
+	switch *method {
+	case "baumwelch":
+		steps, err = hmm.BaumWelch(seqs, *pseudoCount, *maxIter, *tolerance)
+	case "viterbi":
+		steps, err = hmm.ViterbiTraining(seqs, *pseudoCount, *maxIter)
+	default:
+		return fmt.Errorf("train: unknown method %q", *method)
+	}
+	for _, step := range steps {
+		fmt.Printf("%d\t%g\t%d\t%d\n", step.Iteration, step.LogLikelihood, step.Skipped, step.Changed)
+	}
+	if err != nil {
+		return err
+	}
+	if err := hmm.Save(*trOut, *emiOut); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Trained transition and emission matrix produced:", *trOut, *emiOut)
+	if *hmmOut != "" {
+		if err := saveHMMER3(hmm, *hmmOut); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Trained HMMER3 model produced:", *hmmOut)
+	}
+	if *modelOut != "" {
+		if err := hmm.SaveJSON(*modelOut); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Trained JSON model produced:", *modelOut)
+	}
+	return nil
+}
+
+//RunView prints the transition and emission matrices of the model rounded to 4
+//decimals, the way the map files used to be written. It is for reading only;
+//the map files written by build, train and convert keep full precision.
+func RunView(args []string) error {
+	fs := flag.NewFlagSet("view", flag.ContinueOnError)
+	model := modelFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+	hmm.WriteView(os.Stdout)
+	return nil
+}
+
+//RunValidate loads the model and prints every problem that the validator finds
+//in it, one per line, or a line saying the model is valid. The loaders already
+//refuse invalid models; this command lists all the problems instead of the first.
+func RunValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	model := modelFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hmm, err := model.load()
+	var invalid *profilehmm.ValidationError
+	if errors.As(err, &invalid) {
+		for _, problem := range invalid.Problems {
+			fmt.Println(problem)
+		}
+		return fmt.Errorf("validate: %d problems found", len(invalid.Problems))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("valid profile HMM %s with %d match states\n", hmm.Name, hmm.Length)
+	return nil
+}
+
+//RunSummary prints the consensus sequence of the model, the relative entropy of
+//each match state against the background and the expected length, to check a
+//model before using it.
+func RunSummary(args []string) error {
+	fs := flag.NewFlagSet("summary", flag.ContinueOnError)
+	model := modelFlags(fs)
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("summary: unknown format %q", *format)
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+	summary, err := hmm.Summary()
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return summary.WriteJSON(os.Stdout)
+	}
+	summary.WriteText(os.Stdout)
+	return nil
+}
+
+//RunLogo draws the logo of the model into an SVG file, or to stdout without
+//-out.
+func RunLogo(args []string) error {
+	fs := flag.NewFlagSet("logo", flag.ContinueOnError)
+	model := modelFlags(fs)
+	out := fs.String("out", "", "output SVG file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hmm, err := model.load()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return hmm.WriteLogoSVG(os.Stdout)
+	}
+	return hmm.SaveLogoSVG(*out)
+}
+
+//saveHMMER3 writes the model into a HMMER3 file, and warns on stderr if the
+//file can not hold some of its transitions (see HMMERLosses), so that the user
+//knows the model read back from it is not the same, or its calibration.
+func saveHMMER3(hmm *profilehmm.ProfileHMM, filename string) error {
+	if hmm.Calibration != nil {
+		fmt.Fprintf(os.Stderr, "Warning: the calibration is not written to %s, HMMER3 files only keep the STATS that HMMER fits to its own scores\n", filename)
+	}
+	if losses := hmm.HMMERLosses(profilehmm.HMMERLossTolerance); len(losses) > 0 {
+		shown := losses
+		if len(shown) > 5 {
+			shown = append(shown[:5:5], "...")
+		}
+		fmt.Fprintf(os.Stderr, "Warning: HMMER3 files have no I->D or D->I transitions, so %d above %g are left out of %s and the other transitions scaled up: %s\n",
+			len(losses), profilehmm.HMMERLossTolerance, filename, strings.Join(shown, ", "))
+	}
+	return hmm.SaveHMMER3(filename)
+}
+
+//modelFiles are the flag values naming the files a profile HMM is read from:
+//the transition and emission maps, a JSON model file, or a HMMER3 file.
+type modelFiles struct {
+	tr, emi, model, hmm *string
+}
+
+//modelFlags registers the flags for the model files.
+func modelFlags(fs *flag.FlagSet) *modelFiles {
+	return &modelFiles{
+		tr:    fs.String("tr", "", "transition map file"),
+		emi:   fs.String("emi", "", "emission map file"),
+		model: fs.String("model", "", "JSON model file, instead of -tr and -emi"),
+		hmm:   fs.String("hmm", "", "HMMER3 model file (the first model is used), instead of -tr and -emi"),
+	}
+}
+
+//given tells if a model was given on the command line.
+func (files *modelFiles) given() bool {
+	return *files.model != "" || *files.hmm != "" || *files.tr != "" || *files.emi != ""
+}
+
+//load reads the profile HMM from the JSON or HMMER3 file, or from the map files.
+func (files *modelFiles) load() (*profilehmm.ProfileHMM, error) {
+	numGiven := 0
+	for _, given := range []bool{*files.model != "", *files.hmm != "", *files.tr != "" || *files.emi != ""} {
+		if given {
+			numGiven++
+		}
+	}
+	if numGiven > 1 {
+		return nil, errors.New("give only one of -model, -hmm, or -tr and -emi")
+	}
+	switch {
+	case *files.model != "":
+		return profilehmm.LoadJSON(*files.model)
+	case *files.hmm != "":
+		return profilehmm.LoadHMMER3(*files.hmm)
+	case *files.tr == "" || *files.emi == "":
+		return nil, errors.New("a model is required, give -model, -hmm, or -tr and -emi")
+	}
+	return LoadModel(*files.tr, *files.emi)
+}
+
+//modeFlag registers the flag for the align mode.
+func modeFlag(fs *flag.FlagSet, mode profilehmm.AlignMode) *string {
+	return fs.String("mode", string(mode), "align mode: global (whole sequence to whole model), glocal (whole model inside the sequence) or local")
+}
+
+//sequenceFlags registers the flags for the input sequences.
+func sequenceFlags(fs *flag.FlagSet) (seq, in *string) {
+	seq = fs.String("seq", "", "a single sequence (w/o dashes)")
+	in = fs.String("in", "", "FASTA file, or file with one sequence per line, maybe gzipped; - for stdin")
+	return
+}
+
+//reportFailure writes to stderr that a sequence could not be worked on, so that
+//one bad sequence does not stop a whole proteome, and counts it.
+func reportFailure(name string, err error, failed int) int {
+	fmt.Fprintf(os.Stderr, "skipped %s: %v\n", name, err)
+	return failed + 1
+}
+
+//failures warns on stderr how many of the sequences were skipped. The run still
+//succeeds for the others; it only returns an error if none could be worked on.
+func failures(command string, failed, total int) error {
+	switch {
+	case failed == 0:
+		return nil
+	case failed == total:
+		return fmt.Errorf("%s: none of the %d sequences could be worked on", command, total)
+	}
+	fmt.Fprintf(os.Stderr, "%s: skipped %d of %d sequences\n", command, failed, total)
+	return nil
+}
+
+//ReadAlignmentFile opens the alignment file and reads it with the reader for
+//the given format (see profilehmm.ReadAlignment).
+func ReadAlignmentFile(format, filename string) (*profilehmm.Alignment, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return profilehmm.ReadAlignment(file, format)
+}
+
+//OpenInput opens the file, or stdin for "-", and decompresses it on the fly if
+//it is gzipped (told by its first two bytes, not by its name).
+func OpenInput(name string) (io.ReadCloser, error) {
+	var file io.ReadCloser = os.Stdin
+	if name != "-" {
+		var err error
+		if file, err = os.Open(name); err != nil {
+			return nil, err
+		}
+	}
+	buffered := bufio.NewReader(file)
+	magic, _ := buffered.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &inputFile{Reader: gz, closers: []io.Closer{gz, file}}, nil
+	}
+	return &inputFile{Reader: buffered, closers: []io.Closer{file}}, nil
+}
+
+//inputFile is the reader returned by OpenInput, which closes the gzip reader
+//and the file together.
+type inputFile struct {
+	io.Reader
+	closers []io.Closer
+}
+
+//Close closes the gzip reader (if any) and then the file.
+func (input *inputFile) Close() error {
+	var err error
+	for _, closer := range input.closers {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+//ReadFastaFile reads the names and sequences of a FASTA file, gzipped or not,
+//or of stdin for "-".
+func ReadFastaFile(name string) ([]string, []string, error) {
+	file, err := OpenInput(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	return profilehmm.ReadFasta(file)
+}
+
+//ReadSequenceInput takes the -seq and -in flag values and returns the names and
+//the sequences to work on. Either one sequence is given directly (named seq1),
+//or a file (or stdin for "-"), gzipped or not. A file starting with ">" is read
+//as FASTA, records over many lines included, and the sequences are named by
+//their identifiers; otherwise it has one sequence per line, named seq1, seq2 and
+//so on, and blank lines are skipped. The letters are turned to upper case, as the
+//models are, whichever way the sequences are given.
+func ReadSequenceInput(seq, in string) ([]string, []string, error) {
+	if seq != "" && in != "" {
+		return nil, nil, errors.New("give either -seq or -in, not both")
+	}
+	if seq != "" {
+		return []string{"seq1"}, []string{strings.ToUpper(seq)}, nil
+	}
+	if in == "" {
+		return nil, nil, errors.New("a sequence is required, give -seq or -in")
+	}
+
+	file, err := OpenInput(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var names, seqs []string
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, ">") {
+		names, seqs, err = profilehmm.ReadFasta(strings.NewReader(trimmed))
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		for _, line := range strings.Split(trimmed, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				seqs = append(seqs, strings.ToUpper(line))
+				names = append(names, fmt.Sprintf("seq%d", len(seqs)))
+			}
+		}
+	}
+	if len(seqs) == 0 {
+		return nil, nil, errors.New("no sequence found in " + in)
+	}
+	return names, seqs, nil
+}
+
+//LoadModel reads the profile HMM from the transition and emission files. The
+//model is named after the transition file, the way build names its output.
+func LoadModel(trName, emiName string) (*profilehmm.ProfileHMM, error) {
+	name := strings.TrimSuffix(filepath.Base(trName), "TrMap.txt")
+	return profilehmm.LoadProfileHMM(name, trName, emiName)
+}
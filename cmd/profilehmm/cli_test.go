@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	profilehmm "github.com/JiayiShou/Protein-Domain-Finding-with-Hidden-Markov-Model"
+)
+
+const sh3Seed = "../../sample_data/SH3/Pfam_PF00018_seed.txt"
+
+//sh3Model builds the SH3 model of the sample data and writes it to a JSON model
+//file, for the -model flag. It returns the model and the file name.
+func sh3Model(t *testing.T) (*profilehmm.ProfileHMM, string) {
+	t.Helper()
+	alignment, err := ReadAlignmentFile("pfam", sh3Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmm, err := profilehmm.BuildProfileHMM("SH3", profilehmm.DefaultTheta, profilehmm.DefaultPseudoCount, profilehmm.Amino, alignment.Rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "SH3.json")
+	if err := hmm.SaveJSON(name); err != nil {
+		t.Fatal(err)
+	}
+	return hmm, name
+}
+
+//writeInput writes the lines into a file of the test and returns its name.
+func writeInput(t *testing.T, lines ...string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+//TestScoreLowerCaseAndX reads an SH3 domain in lower case with an X in it,
+//given with -seq and in a file of one sequence per line, and checks that it
+//scores like the upper case sequence does.
+func TestScoreLowerCaseAndX(t *testing.T) {
+	hmm, _ := sh3Model(t)
+	domain := "KARYDFCARDRSELSLKEGDIIKILNKKGQQGWWRGEIYGRVGWFPA"
+	lower := strings.ToLower(domain[:10]) + "x" + domain[11:]
+	want, err := hmm.ScoreMode(profilehmm.Local, strings.ToUpper(lower))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []struct{ seq, in string }{{lower, ""}, {"", writeInput(t, lower)}} {
+		_, seqs, err := ReadSequenceInput(input.seq, input.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seqs[0] != strings.ToUpper(lower) {
+			t.Errorf("read %q, want it in upper case", seqs[0])
+		}
+		got, err := hmm.ScoreMode(profilehmm.Local, seqs[0])
+		if err != nil {
+			t.Fatalf("%q: %v", seqs[0], err)
+		}
+		if got != want {
+			t.Errorf("%q scores %g, want %g", seqs[0], got, want)
+		}
+	}
+}
+
+//TestScoreSkipsBadRecords checks that a record that can not be scored is
+//skipped without stopping the others, and that the run only fails when no
+//record could be scored.
+func TestScoreSkipsBadRecords(t *testing.T) {
+	_, model := sh3Model(t)
+	domain := "KARYDFCARDRSELSLKEGDIIKILNKKGQQGWWRGEIYGRVGWFPA"
+	if err := RunScore([]string{"-model", model, "-mode", "local", "-in", writeInput(t, domain, "12345", "acdxklm")}); err != nil {
+		t.Errorf("one bad record failed the run: %v", err)
+	}
+	if err := RunScore([]string{"-model", model, "-in", writeInput(t, "12345", "!!")}); err == nil {
+		t.Error("no error when no record could be scored")
+	}
+}
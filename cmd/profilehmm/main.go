@@ -0,0 +1,64 @@
+//This is the main function of my program involving protein domain and hidden Markov
+//Model. The models themselves are built and used by the profilehmm package at the
+//root of the repository. This file reads what the user asks for and sends it on.
+//The first argument names a subcommand (build, score, align, emit and the others
+//listed in Usage), which cli.go runs non-interactively, so it can be used in
+//scripts and pipelines. "profilehmm menu" starts the interactive menu, which
+//calls the sub option functions in menu.go. Without a subcommand, the usage is
+//printed and the program exits with status 2.
+
+//Programming for Scientist
+//Jiayi Shou Dec.11th 2020
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	profilehmm "github.com/JiayiShou/Protein-Domain-Finding-with-Hidden-Markov-Model"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, Usage)
+		os.Exit(2)
+	}
+	if err := RunCommand(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+//Menu is the interactive mode, run by "profilehmm menu". It reads a single digit
+//from stdin and calls the matching option in menu.go, which then prompts for the
+//rest of the input.
+func Menu() {
+	fmt.Println("\n\n\n--------------------------------------<just a casual dividing line>--------------------------------------")
+	fmt.Print("\nWelcome to Profile Hidden Markov Model for Protein Domains!!\n\n")
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println(" - To produce profile HMM, please press 1 and enter;")
+	fmt.Println(" - To check the chance of a sequece belong to domain family, please press 2 and enter;")
+	fmt.Println(" - To see the most probable path of a sequence aligning to a HMM, please press 3 and enter;")
+	fmt.Println(" - To generate fictional domain sequences with profile HMM, please press 4 and enter.")
+
+	optionFunction, _ := reader.ReadString('\n')
+
+	if optionFunction == "1\n" {
+		//OPTION1: produce profile HMM
+		Option1(profilehmm.Amino, profilehmm.DefaultTheta)
+	} else if optionFunction == "2\n" {
+		//OPTION2: if a sequence belong to a domain family
+		Option2()
+	} else if optionFunction == "3\n" {
+		//OPTION3: check the most probably path of a sequence with a given HMM.
+		Option3()
+	} else if optionFunction == "4\n" {
+		//OPTION4: generate fictional domain sequences with profile HMM.
+		Option4()
+	} else {
+		fmt.Print("\nOooops, didn't match anything. Program end.\n\n")
+	}
+	fmt.Print("\n--------------------------------------------------<END>--------------------------------------------------\n\n")
+}
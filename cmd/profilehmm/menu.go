@@ -0,0 +1,200 @@
+//This file contains the different options to run the program as detailed in the
+//main go file. Specifically ,it contains:
+//1. Build profile HMM given alignments.
+//2. Given profile HMM and strings, a report of their scores and E-values, most significant first.
+//3. Given profile HMM and a string, the most probable path aligning this string to the HMM.
+//4. Given profile HMM, generate fictional strings that belong to the group.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	profilehmm "github.com/JiayiShou/Protein-Domain-Finding-with-Hidden-Markov-Model"
+)
+
+//OPTION1: produce profile HMM
+func Option1(amino []string, theta float64) {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("\nTo produce profile HMM, you just need one alignment file from Pfam or BLAST.")
+	fmt.Println(" - If you got the file from Pfam, press P (or S for Stockholm); if from Blast, press B; or type auto.")
+	PorB, err1 := reader.ReadString('\n')
+	if err1 != nil {
+		panic("PorB read in error.")
+	}
+	PorB = strings.TrimSuffix(PorB, "\n")
+	fmt.Println("\nPlease enter the code of domain family.")
+
+	domain, err2 := reader.ReadString('\n')
+	if err2 != nil {
+		panic("domain code read in error.")
+	}
+	domain = strings.TrimSuffix(domain, "\n")
+
+	fmt.Println("\nPlease enter file name with path (including .txt).")
+	filename, err3 := reader.ReadString('\n')
+	if err3 != nil {
+		panic("filename read in error.")
+	}
+	filename = strings.TrimSuffix(filename, "\n")
+
+	align, err4 := ReadAlignmentFile(PorB, filename)
+	if err4 != nil {
+		fmt.Println("Error: something wrong with openning input files.", err4)
+		return
+	}
+
+	hmm, err5 := profilehmm.BuildProfileHMM(domain, theta, profilehmm.DefaultPseudoCount, amino, align.Rows)
+	if err5 != nil {
+		fmt.Println("Error:", err5)
+		return
+	}
+	if err6 := hmm.Save(domain+"TrMap.txt", domain+"EmiMap.txt"); err6 != nil {
+		fmt.Println("Error:", err6)
+		return
+	}
+	fmt.Println("Emission matrix of ProfileHMM produced! Find it as " + domain + "EmiMap.txt")
+	fmt.Println("Transition matrix of ProfileHMM produced! Find it as " + domain + "TrMap.txt")
+}
+
+//OPTION2: if a sequence belong to a domain family
+func Option2() {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("\nTo check if a sequence belong to a domain family, we would need: ")
+	fmt.Println("    1. The sequence itself (with not dashes or space), or a FASTA file of sequences")
+	fmt.Println("    2. The transition and emission matrix")
+	fmt.Println("Please enter the sequence(w/o dashes) or FASTA file name, file name of transition map and emission map, each on a new line. ")
+
+	str, err1 := reader.ReadString('\n')
+	if err1 != nil {
+		panic("String read in error.")
+	}
+	names, seqs, err1 := ReadMenuSequences(strings.TrimSuffix(str, "\n"))
+	if err1 != nil {
+		fmt.Println("Error:", err1)
+		return
+	}
+
+	hmm, err2 := ReadInHMM()
+	if err2 != nil {
+		fmt.Println("Error:", err2)
+		return
+	}
+	//report every sequence, without thresholds, most significant first.
+	opts := profilehmm.SearchOptions{MinScore: math.Inf(-1), IncDomScore: math.Inf(-1)}
+	hits, failed := hmm.Search(names, seqs, opts)
+	for _, err3 := range failed {
+		fmt.Println("Error:", err3)
+	}
+	fmt.Println()
+	profilehmm.WriteHitsText(os.Stdout, hmm, len(seqs), opts, hits, profilehmm.DefaultAlignmentWidth)
+}
+
+//OPTION3: check the most probably path of a sequence with a given HMM.
+func Option3() {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("\nTo find the most probable path of a sequence aligning to a HMM, we would need: ")
+	fmt.Println("    1. The sequence itself (with not dashes or space), or a FASTA file of sequences")
+	fmt.Println("    2. The transition and emission matrix")
+	fmt.Println("Please enter the sequence(w/o dashes) or FASTA file name, file names of transition map and emission map, each on a new line. ")
+
+	str, err1 := reader.ReadString('\n')
+	if err1 != nil {
+		panic("String read in error.")
+	}
+	names, seqs, err1 := ReadMenuSequences(strings.TrimSuffix(str, "\n"))
+	if err1 != nil {
+		fmt.Println("Error:", err1)
+		return
+	}
+
+	hmm, err2 := ReadInHMM()
+	if err2 != nil {
+		fmt.Println("Error:", err2)
+		return
+	}
+
+	for i := range seqs {
+		path, prPath, err3 := hmm.Decode(seqs[i])
+		if err3 != nil {
+			fmt.Println("Error:", names[i], err3)
+			continue
+		}
+		if len(seqs) > 1 {
+			fmt.Println("\n" + names[i] + ":")
+		}
+		fmt.Println("The most probable path aligns the sequence to the model as: ")
+		fmt.Println()
+		for _, view := range hmm.AlignmentViews(names[i], path, seqs[i]) {
+			view.Write(os.Stdout, profilehmm.DefaultAlignmentWidth)
+		}
+		fmt.Println("The most probable path is: \n\n", path)
+		fmt.Println("\nThe probablity of emitting this path from the transition map is: \n\n", prPath)
+	}
+}
+
+//OPTION4: generate fictional domain sequences with profile HMM.
+func Option4() {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("\nTo generate fictional sequences with an existing HMM, we would need: ")
+	fmt.Println("  1. The transition and emission matrix")
+	fmt.Println("\nPlease enter how many sequence you want, the file names of transition map and emission map, each on a new line. ")
+
+	numSeqStr, err1 := reader.ReadString('\n')
+	if err1 != nil {
+		panic("String read in error.")
+	}
+	numSeq, err2 := strconv.Atoi(strings.TrimSuffix(numSeqStr, "\n"))
+	if err2 != nil {
+		panic("Problem converting read in value into integer.")
+	}
+
+	hmm, err3 := ReadInHMM()
+	if err3 != nil {
+		fmt.Println("Error:", err3)
+		return
+	}
+	var probablyDomainSeq string
+
+	fmt.Print("\nHere are the fictional domain sequences. You can Blast them and see if you got lucky!!\n\n")
+	for n := 0; n < numSeq; n++ {
+		_, probablyDomainSeq = hmm.Sample()
+		fmt.Println(probablyDomainSeq)
+	}
+}
+
+//ReadMenuSequences takes the answer to the sequence question of the menu. If it
+//names a file, the sequences are read from it like the -in flag of the
+//commands (FASTA or one per line, maybe gzipped); otherwise it is the sequence.
+func ReadMenuSequences(answer string) ([]string, []string, error) {
+	if info, err := os.Stat(answer); err == nil && !info.IsDir() {
+		return ReadSequenceInput("", answer)
+	}
+	return ReadSequenceInput(answer, "")
+}
+
+//This function has assumed user input, as asked from upper level function. It
+//takes in name of the files (transition and emission files), and return the
+//profile HMM read from them.
+func ReadInHMM() (*profilehmm.ProfileHMM, error) {
+	reader := bufio.NewReader(os.Stdin)
+
+	trmapName, err2 := reader.ReadString('\n')
+	if err2 != nil {
+		return nil, err2
+	}
+	trmapName = strings.TrimSuffix(trmapName, "\n")
+
+	emimapName, err3 := reader.ReadString('\n')
+	if err3 != nil {
+		return nil, err3
+	}
+	emimapName = strings.TrimSuffix(emimapName, "\n")
+
+	return LoadModel(trmapName, emimapName)
+}
@@ -0,0 +1,206 @@
+//This file contains DenseMtx, the slice backed storage of a transition or emission
+//map. The map of maps is easy to read, write and change, but looking up a string
+//key in the inner loop of Forward and Viterbi is slow. DenseMtx gives each state
+//and each symbol an integer index, so the algorithms only index into a slice.
+//MapToDense and ToMap convert between the two. Real sequences also have letters
+//that stand for more than one symbol, like X for an unknown amino acid;
+//AddDegenerates gives them indexes after the columns, so that they can be
+//scored too.
+
+package profilehmm
+
+import "sort"
+
+//DenseMtx is a matrix stored row by row in one slice. RowHeader and ColHeader
+//give the name of each row and column, in the order of the indexes.
+type DenseMtx struct {
+	RowHeader []string
+	ColHeader []string
+	Data      []float64
+
+	rowIdx      map[string]int
+	colIdx      map[string]int
+	degenerates []degenerate //the symbols of the indexes after the columns
+}
+
+//degenerate is a symbol that is not a column, but stands for some of the
+//columns, each with a weight; the weights sum to 1.
+type degenerate struct {
+	cols    []int
+	weights []float64
+}
+
+//NewDenseMtx takes the header of the row and column, creates a matrix of zeros.
+func NewDenseMtx(rowheader, colheader []string) *DenseMtx {
+	mtx := &DenseMtx{
+		RowHeader: rowheader,
+		ColHeader: colheader,
+		Data:      make([]float64, len(rowheader)*len(colheader)),
+		rowIdx:    make(map[string]int, len(rowheader)),
+		colIdx:    make(map[string]int, len(colheader)),
+	}
+	for r, h := range rowheader {
+		mtx.rowIdx[h] = r
+	}
+	for c, h := range colheader {
+		mtx.colIdx[h] = c
+	}
+	return mtx
+}
+
+//MapToDense takes the row header, colheader and the map, and copies the map into
+//a DenseMtx according to the sequence of the rowheader and colheader. Entries
+//missing from the map are 0, like they are when looked up in the map.
+func MapToDense(rowheader, colheader []string, theMap MtxMap) *DenseMtx {
+	mtx := NewDenseMtx(rowheader, colheader)
+	for r, row := range rowheader {
+		for c, col := range colheader {
+			mtx.Data[r*len(colheader)+c] = theMap[row][col]
+		}
+	}
+	return mtx
+}
+
+//ToMap turns the DenseMtx back into a map of maps, with every entry present.
+func (mtx *DenseMtx) ToMap() MtxMap {
+	theMap := make(MtxMap, len(mtx.RowHeader))
+	for r, row := range mtx.RowHeader {
+		eachEntry := make(map[string]float64, len(mtx.ColHeader))
+		for c, col := range mtx.ColHeader {
+			eachEntry[col] = mtx.At(r, c)
+		}
+		theMap[row] = eachEntry
+	}
+	return theMap
+}
+
+//At returns the entry at row r and column c. A negative column, as Encode gives
+//for a symbol that is not in the column header, is always 0. An index after the
+//columns, as Encode gives for a degenerate symbol, is the weighted mean of the
+//columns it stands for (see Mix).
+func (mtx *DenseMtx) At(r, c int) float64 {
+	if c < 0 {
+		return 0
+	}
+	if c >= len(mtx.ColHeader) {
+		return mtx.Mix(mtx.Row(r), c)
+	}
+	return mtx.Data[r*len(mtx.ColHeader)+c]
+}
+
+//Set changes the entry at row r and column c.
+func (mtx *DenseMtx) Set(r, c int, value float64) {
+	mtx.Data[r*len(mtx.ColHeader)+c] = value
+}
+
+//Row returns row r as a slice sharing the storage of the matrix.
+func (mtx *DenseMtx) Row(r int) []float64 {
+	cols := len(mtx.ColHeader)
+	return mtx.Data[r*cols : (r+1)*cols]
+}
+
+//RowIndex returns the index of the row with the given name.
+func (mtx *DenseMtx) RowIndex(name string) (int, bool) {
+	r, ok := mtx.rowIdx[name]
+	return r, ok
+}
+
+//ColIndex returns the index of the column with the given name.
+func (mtx *DenseMtx) ColIndex(name string) (int, bool) {
+	c, ok := mtx.colIdx[name]
+	return c, ok
+}
+
+//AddDegenerates lets Encode read the symbols of codes (such as DegenerateAmino)
+//that are not columns. Each symbol stands for the columns of its letters, and is
+//emitted with the mean of their emissions weighted by weight (the null model,
+//so that a symbol scores the same against the model and the null model when
+//the model emits like the background). A symbol is left out if one of its
+//letters is not a column. The symbols get their indexes in sorted order, so
+//matrices with the same columns give them the same indexes.
+func (mtx *DenseMtx) AddDegenerates(codes map[string][]string, weight map[string]float64) {
+	symbols := make([]string, 0, len(codes))
+	for symbol := range codes {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		if _, ok := mtx.colIdx[symbol]; ok {
+			continue
+		}
+		var code degenerate
+		total := 0.0
+		for _, letter := range codes[symbol] {
+			c, ok := mtx.colIdx[letter]
+			if !ok || c >= len(mtx.ColHeader) {
+				code.cols = nil
+				break
+			}
+			code.cols = append(code.cols, c)
+			code.weights = append(code.weights, weight[letter])
+			total += weight[letter]
+		}
+		if len(code.cols) == 0 {
+			continue
+		}
+		for i := range code.weights {
+			if total > 0 {
+				code.weights[i] /= total
+			} else { //no weights: the plain mean
+				code.weights[i] = 1 / float64(len(code.cols))
+			}
+		}
+		mtx.colIdx[symbol] = len(mtx.ColHeader) + len(mtx.degenerates)
+		mtx.degenerates = append(mtx.degenerates, code)
+	}
+}
+
+//Mix returns values[c] for a column c, and for the index of a degenerate symbol,
+//the weighted mean of the values of the columns it stands for. The values are
+//one per column, like a row of the matrix.
+func (mtx *DenseMtx) Mix(values []float64, c int) float64 {
+	if c < len(mtx.ColHeader) {
+		return values[c]
+	}
+	code := mtx.degenerates[c-len(mtx.ColHeader)]
+	mix := 0.0
+	for i, col := range code.cols {
+		mix += code.weights[i] * values[col]
+	}
+	return mix
+}
+
+//Shares splits an emission of c by row r among the columns: all of it goes to
+//column c, and an emission of a degenerate symbol goes to each column it stands
+//for as much as that column is likely to have been the one emitted.
+func (mtx *DenseMtx) Shares(r, c int) (cols []int, shares []float64) {
+	if c < len(mtx.ColHeader) {
+		return []int{c}, []float64{1}
+	}
+	code := mtx.degenerates[c-len(mtx.ColHeader)]
+	total := mtx.At(r, c)
+	if total <= 0 {
+		return nil, nil
+	}
+	for i, col := range code.cols {
+		cols = append(cols, col)
+		shares = append(shares, code.weights[i]*mtx.At(r, col)/total)
+	}
+	return cols, shares
+}
+
+//Encode turns a string into the column indexes of its letters, so that an
+//emission matrix can be looked up by position. A degenerate symbol added by
+//AddDegenerates gets its index after the columns, and any other letter that is
+//not in the column header becomes -1, which emits with probability 0.
+func (mtx *DenseMtx) Encode(str string) []int {
+	seq := make([]int, len(str))
+	for s := range seq {
+		if c, ok := mtx.colIdx[str[s:s+1]]; ok {
+			seq[s] = c
+		} else {
+			seq[s] = -1
+		}
+	}
+	return seq
+}
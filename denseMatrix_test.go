@@ -0,0 +1,83 @@
+package profilehmm
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+//TestAddDegenerates checks the indexes Encode gives to degenerate symbols, the
+//weighted mean At returns for them, and how Shares splits their counts.
+func TestAddDegenerates(t *testing.T) {
+	mtx := MapToDense([]string{"S"}, []string{"A", "C", "D"}, MtxMap{"S": {"A": 0.2, "C": 0.3, "D": 0.5}})
+	mtx.AddDegenerates(map[string][]string{
+		"X": {"A", "C", "D"},
+		"B": {"C", "D"},
+		"Q": {"A", "Q"}, //Q is not a column: left out
+		"A": {"C"},      //A is a column already: kept as it is
+	}, map[string]float64{"A": 0.5, "C": 0.25, "D": 0.25})
+
+	if got, want := mtx.Encode("AXBQD"), []int{0, 4, 3, -1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode = %v, want %v", got, want)
+	}
+	if got, want := mtx.At(0, 4), 0.5*0.2+0.25*0.3+0.25*0.5; math.Abs(got-want) > 1e-12 {
+		t.Errorf("At(X) = %g, want %g", got, want)
+	}
+	if got, want := mtx.At(0, 3), 0.5*0.3+0.5*0.5; math.Abs(got-want) > 1e-12 {
+		t.Errorf("At(B) = %g, want %g", got, want)
+	}
+
+	cols, shares := mtx.Shares(0, 3)
+	if !reflect.DeepEqual(cols, []int{1, 2}) || math.Abs(shares[0]-0.375) > 1e-12 || math.Abs(shares[1]-0.625) > 1e-12 {
+		t.Errorf("Shares(B) = %v %v, want [1 2] [0.375 0.625]", cols, shares)
+	}
+	if cols, shares := mtx.Shares(0, 1); !reflect.DeepEqual(cols, []int{1}) || !reflect.DeepEqual(shares, []float64{1}) {
+		t.Errorf("Shares(C) = %v %v, want [1] [1]", cols, shares)
+	}
+}
+
+//TestScoreDegenerate scores an SH3 domain with an X in it, in every align mode.
+//The probability of a sequence is linear in the emission of one of its
+//residues, both under the model and the null model, so the score with X lies
+//between the lowest and the highest score with an amino acid in its place.
+func TestScoreDegenerate(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	seq := sampleSequences(t, "sample_data/SH3/Pfam_PF00018_seed.txt")[0]
+	const pos = 10
+	withX := seq[:pos] + "X" + seq[pos+1:]
+
+	for _, mode := range []AlignMode{Global, Glocal, Local} {
+		t.Run(string(mode), func(t *testing.T) {
+			score, err := hmm.ScoreMode(mode, withX)
+			if err != nil {
+				t.Fatal(err)
+			}
+			low, high := math.Inf(1), math.Inf(-1)
+			for _, letter := range Amino {
+				s, err := hmm.ScoreMode(mode, seq[:pos]+letter+seq[pos+1:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				low, high = math.Min(low, s), math.Max(high, s)
+			}
+			if score < low-1e-9 || score > high+1e-9 {
+				t.Errorf("score with X is %g, not between %g and %g", score, low, high)
+			}
+		})
+	}
+
+	//every other degenerate letter, in the model and in training.
+	odd := "BZJUO" + seq[5:]
+	if _, err := hmm.PosteriorMode(Local, odd); err != nil {
+		t.Errorf("posterior: %v", err)
+	}
+	if _, _, err := hmm.DecodeMode(Glocal, odd); err != nil {
+		t.Errorf("decode: %v", err)
+	}
+	if _, err := hmm.BaumWelch([]string{odd, withX}, DefaultPseudoCount, 1, 0); err != nil {
+		t.Errorf("training: %v", err)
+	}
+	if problems := ValidateMaps(hmm.Alphabet, hmm.States, hmm.Trmap, hmm.Emimap); len(problems) > 0 {
+		t.Errorf("trained model is not valid: %v", problems)
+	}
+}
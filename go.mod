@@ -0,0 +1,3 @@
+module github.com/JiayiShou/Protein-Domain-Finding-with-Hidden-Markov-Model
+
+go 1.21
@@ -0,0 +1,195 @@
+//This file draws the logo of a profile HMM as an SVG picture, to see at a
+//glance which residues the model conserves, like the WW of SH3. Each match
+//state is a column of letters stacked on each other: the column is as high as
+//the relative entropy of the state against the background (see
+//RelativeEntropy), and each letter takes the part of it that the state emits
+//the letter, the most likely on top. Two tracks under the letters show, for
+//each match state, the probability of going into the insert state after it and
+//of skipping it by its delete state, which tell where the family has gaps.
+//Only the standard library is used: the letters are SVG text scaled to their
+//heights, so the picture opens in any browser.
+
+package profilehmm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+//Sizes of the logo in pixels: the width of each column, the height of one bit,
+//the height of each track, and the margin left of the columns for the axis.
+const (
+	LogoColumnWidth = 24
+	LogoBitHeight   = 40
+	LogoTrackHeight = 30
+	LogoMargin      = 50
+)
+
+//logoCapHeight is the height of a capital letter in units of the font size,
+//for the bold sans serif fonts of browsers; the letters are scaled with it to
+//the height of their part of the column.
+const logoCapHeight = 0.72
+
+//logoColors colors the amino acids by their chemistry, as in the ClustalX and
+//HMMER logos: hydrophobic blue, positive red, negative magenta, polar green,
+//glycine orange, proline yellow, aromatic cyan and cysteine pink.
+var logoColors = map[string]string{
+	"A": "#1f5fbf", "I": "#1f5fbf", "L": "#1f5fbf", "M": "#1f5fbf", "V": "#1f5fbf",
+	"K": "#d62728", "R": "#d62728",
+	"D": "#b0269c", "E": "#b0269c",
+	"N": "#2ca02c", "Q": "#2ca02c", "S": "#2ca02c", "T": "#2ca02c",
+	"G": "#ef8f1f",
+	"P": "#c9b200",
+	"F": "#17a2b8", "W": "#17a2b8", "Y": "#17a2b8", "H": "#17a2b8",
+	"C": "#e377c2",
+}
+
+//SaveLogoSVG writes the logo of the model into the file (see WriteLogoSVG).
+func (hmm *ProfileHMM) SaveLogoSVG(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := hmm.WriteLogoSVG(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//WriteLogoSVG writes the logo of the model as an SVG picture. The axis of the
+//letters goes up to the highest relative entropy rounded up to a whole bit, and
+//the match states are numbered every 5 columns under the tracks.
+func (hmm *ProfileHMM) WriteLogoSVG(w io.Writer) error {
+	if hmm.Length == 0 {
+		return fmt.Errorf("the model %s has no match states to draw", hmm.Name)
+	}
+	entropy := hmm.RelativeEntropy()
+	maxBits := 1.0
+	for _, bits := range entropy {
+		maxBits = math.Max(maxBits, math.Ceil(bits))
+	}
+
+	top := 30.0 //room for the title
+	letterBottom := top + maxBits*LogoBitHeight
+	insertTop := letterBottom + 10
+	deleteTop := insertTop + LogoTrackHeight + 10
+	numberTop := deleteTop + LogoTrackHeight + 15
+	width := LogoMargin + hmm.Length*LogoColumnWidth + 10
+	height := numberTop + 10
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%g\" viewBox=\"0 0 %d %g\" font-family=\"Arial, Helvetica, sans-serif\">\n", width, height, width, height)
+	fmt.Fprintln(&svg, "<rect width=\"100%\" height=\"100%\" fill=\"white\"/>")
+	fmt.Fprintf(&svg, "<text x=\"%d\" y=\"20\" font-size=\"14\">%s  (%d match states, %.2f bits per state)</text>\n",
+		LogoMargin, escapeXML(hmm.Name), hmm.Length, mean(entropy))
+
+	//the axis of the letters, with a tick for every bit.
+	fmt.Fprintf(&svg, "<line x1=\"%d\" y1=\"%g\" x2=\"%d\" y2=\"%g\" stroke=\"black\"/>\n", LogoMargin-2, top, LogoMargin-2, letterBottom)
+	for bit := 0.0; bit <= maxBits; bit++ {
+		y := letterBottom - bit*LogoBitHeight
+		fmt.Fprintf(&svg, "<line x1=\"%d\" y1=\"%g\" x2=\"%d\" y2=\"%g\" stroke=\"black\"/>\n", LogoMargin-6, y, LogoMargin-2, y)
+		fmt.Fprintf(&svg, "<text x=\"%d\" y=\"%g\" font-size=\"10\" text-anchor=\"end\">%g</text>\n", LogoMargin-8, y+3, bit)
+	}
+	fmt.Fprintf(&svg, "<text x=\"12\" y=\"%g\" font-size=\"11\" text-anchor=\"middle\" transform=\"rotate(-90 12 %g)\">bits</text>\n",
+		(top+letterBottom)/2, (top+letterBottom)/2)
+
+	//the letters of each column, the least likely at the bottom.
+	for k := 1; k <= hmm.Length; k++ {
+		row := hmm.Emimap["M"+strconv.Itoa(k)]
+		letters := append([]string{}, hmm.Alphabet...)
+		sort.SliceStable(letters, func(i, j int) bool { return row[letters[i]] < row[letters[j]] })
+		x := float64(LogoMargin + (k-1)*LogoColumnWidth)
+		y := letterBottom
+		for _, letter := range letters {
+			letterHeight := row[letter] * entropy[k-1] * LogoBitHeight
+			if letterHeight < 0.5 { //too small to see
+				continue
+			}
+			color, ok := logoColors[letter]
+			if !ok {
+				color = "black"
+			}
+			fmt.Fprintf(&svg, "<text transform=\"translate(%.2f %.2f) scale(1 %.4f)\" x=\"0\" y=\"0\" font-size=\"100\" font-weight=\"bold\" fill=\"%s\" textLength=\"%d\" lengthAdjust=\"spacingAndGlyphs\">%s</text>\n",
+				x+1, y, letterHeight/(100*logoCapHeight), color, LogoColumnWidth-2, escapeXML(letter))
+			y -= letterHeight
+		}
+	}
+
+	//the tracks: a bar as high as the probability of the insertion or deletion.
+	insert, deletion := hmm.gapProbabilities()
+	tracks := []struct {
+		name  string
+		top   float64
+		probs []float64
+		color string
+	}{
+		{"insert", insertTop, insert, "#8c564b"},
+		{"delete", deleteTop, deletion, "#7f7f7f"},
+	}
+	for _, track := range tracks {
+		bottom := track.top + LogoTrackHeight
+		fmt.Fprintf(&svg, "<rect x=\"%d\" y=\"%g\" width=\"%d\" height=\"%d\" fill=\"none\" stroke=\"#cccccc\"/>\n",
+			LogoMargin, track.top, hmm.Length*LogoColumnWidth, LogoTrackHeight)
+		fmt.Fprintf(&svg, "<text x=\"%d\" y=\"%g\" font-size=\"10\" text-anchor=\"end\">%s</text>\n", LogoMargin-4, bottom-LogoTrackHeight/2+3, track.name)
+		for k, pr := range track.probs {
+			barHeight := pr * LogoTrackHeight
+			fmt.Fprintf(&svg, "<rect x=\"%d\" y=\"%.2f\" width=\"%d\" height=\"%.2f\" fill=\"%s\"><title>%s %d: %.3f</title></rect>\n",
+				LogoMargin+k*LogoColumnWidth+2, bottom-barHeight, LogoColumnWidth-4, barHeight, track.color, track.name, k+1, pr)
+		}
+	}
+
+	for k := 1; k <= hmm.Length; k++ {
+		if k == 1 || k%5 == 0 {
+			fmt.Fprintf(&svg, "<text x=\"%d\" y=\"%g\" font-size=\"10\" text-anchor=\"middle\">%d</text>\n",
+				LogoMargin+(k-1)*LogoColumnWidth+LogoColumnWidth/2, numberTop, k)
+		}
+	}
+	fmt.Fprintln(&svg, "</svg>")
+
+	_, err := w.Write(svg.Bytes())
+	return err
+}
+
+//gapProbabilities returns, for each match state k, the probability of going
+//from Mk into Ik, and of going into Dk from the state before it (Start for k =
+//1) instead of into Mk.
+func (hmm *ProfileHMM) gapProbabilities() (insert, deletion []float64) {
+	insert = make([]float64, hmm.Length)
+	deletion = make([]float64, hmm.Length)
+	for k := 1; k <= hmm.Length; k++ {
+		node := strconv.Itoa(k)
+		insert[k-1] = hmm.Trmap["M"+node]["I"+node]
+		before := "Start"
+		if k > 1 {
+			before = "M" + strconv.Itoa(k-1)
+		}
+		deletion[k-1] = hmm.Trmap[before]["D"+node]
+	}
+	return insert, deletion
+}
+
+//mean returns the mean of the numbers, or 0 if there are none.
+func mean(numbers []float64) float64 {
+	if len(numbers) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range numbers {
+		sum += x
+	}
+	return sum / float64(len(numbers))
+}
+
+//escapeXML escapes the text for the inside of an SVG element.
+func escapeXML(text string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(text))
+	return escaped.String()
+}
@@ -0,0 +1,80 @@
+package profilehmm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+//svgLogo is the part of the logo the test looks at: the letters, which are the
+//bold text elements, and the bars of the tracks, which have a title.
+type svgLogo struct {
+	XMLName xml.Name `xml:"svg"`
+	Texts   []struct {
+		Transform string `xml:"transform,attr"`
+		Weight    string `xml:"font-weight,attr"`
+		Letter    string `xml:",chardata"`
+	} `xml:"text"`
+	Rects []struct {
+		Title string `xml:"title"`
+	} `xml:"rect"`
+}
+
+//TestWriteLogoSVG checks that the logos of the tiny model (with a name that
+//must be escaped) and of the SH3 model are well formed XML, with a column of
+//letters and a bar in each track for every match state.
+func TestWriteLogoSVG(t *testing.T) {
+	tiny := tinyProfileHMM(t)
+	tiny.Name = "tiny <&> model"
+	for _, hmm := range []*ProfileHMM{tiny, buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")} {
+		var out bytes.Buffer
+		if err := hmm.WriteLogoSVG(&out); err != nil {
+			t.Fatal(err)
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(out.Bytes()))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: logo is not well formed: %v", hmm.Name, err)
+			}
+		}
+		var logo svgLogo
+		if err := xml.Unmarshal(out.Bytes(), &logo); err != nil {
+			t.Fatal(err)
+		}
+
+		columns := make(map[string]bool) //the x of the letters
+		for _, text := range logo.Texts {
+			if text.Weight != "bold" {
+				continue
+			}
+			x := strings.Fields(strings.TrimPrefix(text.Transform, "translate("))[0]
+			columns[x] = true
+		}
+		if len(columns) != hmm.Length {
+			t.Errorf("%s: letters in %d columns, want %d", hmm.Name, len(columns), hmm.Length)
+		}
+		bars := make(map[string]bool)
+		for _, rect := range logo.Rects {
+			if rect.Title != "" {
+				bars[strings.SplitN(rect.Title, ":", 2)[0]] = true
+			}
+		}
+		for k := 1; k <= hmm.Length; k++ {
+			for _, track := range []string{"insert", "delete"} {
+				if !bars[fmt.Sprintf("%s %d", track, k)] {
+					t.Errorf("%s: no %s bar for match state %d", hmm.Name, track, k)
+				}
+			}
+		}
+		if len(bars) != 2*hmm.Length {
+			t.Errorf("%s: %d bars, want %d", hmm.Name, len(bars), 2*hmm.Length)
+		}
+	}
+}
@@ -0,0 +1,491 @@
+//This file reads and writes profile HMMs in the HMMER3 text format (.hmm), the
+//format of hmmbuild and of the Pfam HMM libraries. In it, each node k has the
+//match emissions of Mk, the insert emissions of Ik and seven transitions:
+//Mk->Mk+1, Mk->Ik, Mk->Dk+1, Ik->Mk+1, Ik->Ik, Dk->Mk+1 and Dk->Dk+1. Node 0
+//is Start (B in HMMER) and I0. All the probabilities are written as negative
+//natural logs, with "*" for a probability of 0.
+//HMMER's Plan7 architecture has no I->D or D->I transitions, which our models
+//do have. When writing, those are left out and the other transitions of the
+//state are scaled up to sum to 1 again, so a model read back may differ; the
+//more an alignment has insertions next to deletions, the more. HMMERLosses
+//lists the transitions left out, so that the user can be warned.
+//The STATS LOCAL lines of a HMMER3 file are kept in HMMERStats and written back
+//as they were, but never used for our E-values: HMMER fitted them to its own
+//null model and scores (MSV and filtered Forward), not to ours. For the same
+//reason our Calibration is not written as STATS lines, which hmmsearch would
+//take for its own; run calibrate on a model read from a HMMER3 file, and
+//hmmbuild on the alignment for a model that hmmsearch can calibrate.
+
+package profilehmm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//HMMERAmino is the order HMMER writes the amino acids in.
+var HMMERAmino = []string{"A", "C", "D", "E", "F", "G", "H", "I", "K", "L", "M", "N", "P", "Q", "R", "S", "T", "V", "W", "Y"}
+
+//hmmerTransitions are the seven transitions of a node, as the letters of the
+//states they go from and to, in HMMER's order.
+var hmmerTransitions = [7][2]string{{"M", "M"}, {"M", "I"}, {"M", "D"}, {"I", "M"}, {"I", "I"}, {"D", "M"}, {"D", "D"}}
+
+//HMMERStats are the STATS LOCAL lines of a HMMER3 file: the location and slope
+//of the Gumbel distributions of HMMER's MSV and Viterbi scores, and the tau and
+//lambda of the exponential tail of its Forward scores. They only fit HMMER's
+//scores, so they are kept apart from Calibration.
+type HMMERStats struct {
+	MSVMu         float64 `json:"msv_mu"`
+	MSVLambda     float64 `json:"msv_lambda"`
+	ViterbiMu     float64 `json:"viterbi_mu"`
+	ViterbiLambda float64 `json:"viterbi_lambda"`
+	ForwardTau    float64 `json:"forward_tau"`
+	ForwardLambda float64 `json:"forward_lambda"`
+}
+
+//HMMERLossTolerance is the probability of an I->D or D->I transition above
+//which writing the model into a HMMER3 file changes it enough to be worth a
+//warning.
+const HMMERLossTolerance = 0.01
+
+//HMMERLosses returns the I->D and D->I transitions of the model with a
+//probability above tolerance, which WriteHMMER3 leaves out, written like
+//"I3->D4 0.2500", in the order of the states.
+func (hmm *ProfileHMM) HMMERLosses(tolerance float64) []string {
+	var losses []string
+	for _, from := range hmm.States {
+		for _, to := range hmm.States {
+			if (from[0] == 'I' && to[0] == 'D') || (from[0] == 'D' && to[0] == 'I') {
+				if pr := hmm.Trmap[from][to]; pr > tolerance {
+					losses = append(losses, fmt.Sprintf("%s->%s %.4f", from, to, pr))
+				}
+			}
+		}
+	}
+	return losses
+}
+
+//SaveHMMER3 writes the model into a file in HMMER3 format with WriteHMMER3.
+func (hmm *ProfileHMM) SaveHMMER3(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := hmm.WriteHMMER3(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//WriteHMMER3 writes the model in HMMER3/f format. The COMPO line is the mean of
+//the match emissions. The consensus column has the most probable residue of each
+//match state, in lower case if its probability is below 0.5. The STATS lines are
+//written only for HMMERStats read from a HMMER3 file. It returns an error if the
+//model is not a profile HMM of the 20 amino acids.
+func (hmm *ProfileHMM) WriteHMMER3(w io.Writer) error {
+	numMatch, ok := ProfileLength(hmm.States)
+	if !ok {
+		return errors.New("hmmer3: the states are not those of a profile HMM")
+	}
+	inSigma := make(map[string]bool, len(hmm.Alphabet))
+	for _, letter := range hmm.Alphabet {
+		inSigma[letter] = true
+	}
+	for _, letter := range HMMERAmino {
+		if !inSigma[letter] {
+			return fmt.Errorf("hmmer3: sigma has no %s, only amino acid models can be written", letter)
+		}
+	}
+	trans := plan7Transitions(hmm.Trmap, numMatch)
+
+	name := hmm.Name
+	if name == "" {
+		name = "profilehmm"
+	}
+	fmt.Fprintln(w, "HMMER3/f [profilehmm]")
+	fmt.Fprintf(w, "NAME  %s\n", name)
+	if hmm.Accession != "" {
+		fmt.Fprintf(w, "ACC   %s\n", hmm.Accession)
+	}
+	if hmm.Description != "" {
+		fmt.Fprintf(w, "DESC  %s\n", hmm.Description)
+	}
+	fmt.Fprintf(w, "LENG  %d\n", numMatch)
+	fmt.Fprintln(w, "ALPH  amino")
+	fmt.Fprintln(w, "RF    no")
+	fmt.Fprintln(w, "MM    no")
+	fmt.Fprintln(w, "CONS  yes")
+	fmt.Fprintln(w, "CS    no")
+	fmt.Fprintln(w, "MAP   no")
+	if hmm.NumSeqs > 0 {
+		fmt.Fprintf(w, "NSEQ  %d\n", hmm.NumSeqs)
+	}
+	if stats := hmm.HMMERStats; stats != nil {
+		fmt.Fprintf(w, "STATS LOCAL MSV      %8.4f %8.5f\n", stats.MSVMu, stats.MSVLambda)
+		fmt.Fprintf(w, "STATS LOCAL VITERBI  %8.4f %8.5f\n", stats.ViterbiMu, stats.ViterbiLambda)
+		fmt.Fprintf(w, "STATS LOCAL FORWARD  %8.4f %8.5f\n", stats.ForwardTau, stats.ForwardLambda)
+	}
+
+	fmt.Fprint(w, "HMM     ")
+	for _, letter := range HMMERAmino {
+		fmt.Fprintf(w, "     %s   ", letter)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "            m->m     m->i     m->d     i->m     i->i     d->m     d->d")
+
+	compo := make([]float64, len(HMMERAmino))
+	for k := 1; k <= numMatch; k++ {
+		for x, letter := range HMMERAmino {
+			compo[x] += hmm.Emimap["M"+strconv.Itoa(k)][letter] / float64(numMatch)
+		}
+	}
+	fmt.Fprint(w, "  COMPO ")
+	writeHMMERRow(w, compo)
+	fmt.Fprintln(w)
+
+	for k := 0; k <= numMatch; k++ {
+		if k > 0 {
+			match := hmmerEmissions(hmm.Emimap["M"+strconv.Itoa(k)])
+			fmt.Fprintf(w, " %6d ", k)
+			writeHMMERRow(w, match)
+			fmt.Fprintf(w, "      - %s - - -\n", hmm.consensusResidue(k))
+		}
+		fmt.Fprint(w, "        ")
+		writeHMMERRow(w, hmmerEmissions(hmm.Emimap["I"+strconv.Itoa(k)]))
+		fmt.Fprintln(w)
+		fmt.Fprint(w, "        ")
+		writeHMMERRow(w, trans[k][:])
+		fmt.Fprintln(w)
+	}
+	_, err := fmt.Fprintln(w, "//")
+	return err
+}
+
+//hmmerEmissions returns the emission rates of a state in HMMER's order.
+func hmmerEmissions(row map[string]float64) []float64 {
+	rates := make([]float64, len(HMMERAmino))
+	for x, letter := range HMMERAmino {
+		rates[x] = row[letter]
+	}
+	return rates
+}
+
+//writeHMMERRow writes probabilities as negative natural logs, "*" for 0.
+func writeHMMERRow(w io.Writer, probs []float64) {
+	for _, pr := range probs {
+		if pr <= 0 {
+			fmt.Fprintf(w, "  %7s", "*")
+		} else {
+			fmt.Fprintf(w, "  %7.5f", math.Abs(-math.Log(pr))) //Abs keeps -0.00000 from being written
+		}
+	}
+}
+
+//plan7Transitions returns the seven transitions of each node 0 to numMatch. The
+//D->I and I->D transitions are dropped and the rest of the row scaled to sum to
+//1. Start stands for M0, End for Mk+1 of the last node. D0 does not exist, so it
+//gets the fixed values HMMER writes for it (d->m 1, d->d 0), like the last Dk.
+func plan7Transitions(trmap MtxMap, numMatch int) [][7]float64 {
+	state := func(kind string, k int) string {
+		switch {
+		case kind == "M" && k == 0:
+			return "Start"
+		case kind == "M" && k > numMatch:
+			return "End"
+		case kind == "D" && (k == 0 || k > numMatch):
+			return ""
+		}
+		return kind + strconv.Itoa(k)
+	}
+
+	trans := make([][7]float64, numMatch+1)
+	for k := 0; k <= numMatch; k++ {
+		sums := make(map[string]float64)
+		for t, pair := range hmmerTransitions {
+			next := k + 1
+			if pair[1] == "I" {
+				next = k
+			}
+			from, to := state(pair[0], k), state(pair[1], next)
+			if from == "" || to == "" {
+				continue
+			}
+			trans[k][t] = trmap[from][to]
+			sums[pair[0]] += trans[k][t]
+		}
+		for t, pair := range hmmerTransitions {
+			if sums[pair[0]] > 0 {
+				trans[k][t] /= sums[pair[0]]
+			}
+		}
+		if sums["D"] == 0 {
+			trans[k][5], trans[k][6] = 1, 0
+		}
+	}
+	return trans
+}
+
+//LoadHMMER3 reads the first model of a HMMER3 file.
+func LoadHMMER3(filename string) (*ProfileHMM, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hmms, err := ReadHMMER3(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return hmms[0], nil
+}
+
+//ReadHMMER3 reads all the models of a HMMER3 text file, such as Pfam-A.hmm.
+//The versions 3/a to 3/f are read the same way: the header lines NAME, ACC,
+//DESC, LENG, ALPH, NSEQ and STATS LOCAL (into HMMERStats, not Calibration) are
+//used and the other ones skipped, and of each
+//node line only the node number and the 20 emissions are used. Only amino acid
+//models can be read, and each is checked with ValidateMaps. The models get the
+//sigma Amino and BackgroundProtein as their null model.
+func ReadHMMER3(file io.Reader) ([]*ProfileHMM, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNum := 0
+	next := func() ([]string, bool) {
+		for scanner.Scan() {
+			lineNum++
+			if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+				return fields, true
+			}
+		}
+		return nil, false
+	}
+
+	var hmms []*ProfileHMM
+	for {
+		fields, ok := next()
+		if !ok {
+			break
+		}
+		if !strings.HasPrefix(fields[0], "HMMER3/") {
+			return nil, fmt.Errorf("hmmer3 line %d: expected a HMMER3 header line, got %q", lineNum, fields[0])
+		}
+		hmm, err := readHMMER3Model(next, &lineNum)
+		if err != nil {
+			return nil, err
+		}
+		hmms = append(hmms, hmm)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(hmms) == 0 {
+		return nil, errors.New("hmmer3: no model found")
+	}
+	return hmms, nil
+}
+
+//readHMMER3Model reads one model, after its HMMER3/ line, up to its "//" line.
+func readHMMER3Model(next func() ([]string, bool), lineNum *int) (*ProfileHMM, error) {
+	var name, acc, desc string
+	numMatch, numSeqs := 0, 0
+	var stats map[string][2]float64 //the MSV, VITERBI and FORWARD lines of STATS LOCAL, if given.
+
+	//header
+	for {
+		fields, ok := next()
+		if !ok {
+			return nil, errors.New("hmmer3: file ends inside a model header")
+		}
+		if fields[0] == "HMM" {
+			break
+		}
+		value := ""
+		if len(fields) > 1 {
+			value = strings.Join(fields[1:], " ")
+		}
+		switch fields[0] {
+		case "NAME":
+			name = value
+		case "ACC":
+			acc = value
+		case "DESC":
+			desc = value
+		case "LENG", "NSEQ":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("hmmer3 line %d: bad %s %q", *lineNum, fields[0], value)
+			}
+			if fields[0] == "LENG" {
+				numMatch = n
+			} else {
+				numSeqs = n
+			}
+		case "ALPH":
+			if strings.ToLower(value) != "amino" {
+				return nil, fmt.Errorf("hmmer3 line %d: alphabet %s, only amino models can be read", *lineNum, value)
+			}
+		case "STATS":
+			if len(fields) != 5 || fields[1] != "LOCAL" {
+				return nil, fmt.Errorf("hmmer3 line %d: bad STATS line %q", *lineNum, value)
+			}
+			if fields[2] != "MSV" && fields[2] != "VITERBI" && fields[2] != "FORWARD" {
+				continue
+			}
+			var pair [2]float64
+			for i := range pair {
+				n, err := strconv.ParseFloat(fields[3+i], 64)
+				if err != nil {
+					return nil, fmt.Errorf("hmmer3 line %d: bad STATS value %q", *lineNum, fields[3+i])
+				}
+				pair[i] = n
+			}
+			if stats == nil {
+				stats = make(map[string][2]float64)
+			}
+			stats[fields[2]] = pair
+		}
+	}
+	if numMatch < 1 {
+		return nil, fmt.Errorf("hmmer3 model %s: missing LENG line", name)
+	}
+
+	states := MakeMapHeader(numMatch)
+	trmap := CreatEmptyMap(states, states)
+	emimap := CreatEmptyMap(states, Amino)
+
+	//parse reads n numbers (negative natural logs) from the fields, after skip fields.
+	parse := func(fields []string, n, skip int) ([]float64, error) {
+		if len(fields) < n+skip {
+			return nil, fmt.Errorf("hmmer3 line %d: expected %d values, got %d", *lineNum, n, len(fields)-skip)
+		}
+		values := make([]float64, n)
+		for i, field := range fields[skip : skip+n] {
+			if field == "*" {
+				continue
+			}
+			logPr, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("hmmer3 line %d: bad value %q", *lineNum, field)
+			}
+			values[i] = math.Exp(-logPr)
+		}
+		return values, nil
+	}
+	nextFields := func() ([]string, error) {
+		fields, ok := next()
+		if !ok {
+			return nil, errors.New("hmmer3: file ends inside a model")
+		}
+		return fields, nil
+	}
+	setEmissions := func(state string, values []float64) {
+		for x, letter := range HMMERAmino {
+			emimap[state][letter] = values[x]
+		}
+	}
+
+	if _, err := nextFields(); err != nil { //the line of transition names under the HMM line
+		return nil, err
+	}
+	for k := 0; k <= numMatch; k++ {
+		fields, err := nextFields()
+		if err != nil {
+			return nil, err
+		}
+		if k > 0 {
+			if fields[0] != strconv.Itoa(k) {
+				return nil, fmt.Errorf("hmmer3 line %d: expected the match emissions of node %d", *lineNum, k)
+			}
+			match, err := parse(fields, len(HMMERAmino), 1)
+			if err != nil {
+				return nil, err
+			}
+			setEmissions("M"+strconv.Itoa(k), match)
+			fields, err = nextFields()
+		} else if fields[0] == "COMPO" { //the COMPO line is optional
+			fields, err = nextFields()
+		}
+		if err != nil {
+			return nil, err
+		}
+		insert, err := parse(fields, len(HMMERAmino), 0)
+		if err != nil {
+			return nil, err
+		}
+		setEmissions("I"+strconv.Itoa(k), insert)
+
+		if fields, err = nextFields(); err != nil {
+			return nil, err
+		}
+		trans, err := parse(fields, len(hmmerTransitions), 0)
+		if err != nil {
+			return nil, err
+		}
+		setPlan7Transitions(trmap, k, numMatch, trans)
+	}
+	fields, ok := next()
+	if !ok || fields[0] != "//" {
+		return nil, fmt.Errorf("hmmer3 model %s: missing \"//\" at the end", name)
+	}
+
+	if err := validateOrFail(Amino, states, trmap, emimap); err != nil {
+		return nil, fmt.Errorf("hmmer3 model %s: %w", name, err)
+	}
+	hmm, err := NewProfileHMM(name, Amino, states, trmap, emimap)
+	if err != nil {
+		return nil, fmt.Errorf("hmmer3 model %s: %w", name, err)
+	}
+	hmm.Accession = acc
+	hmm.Description = desc
+	hmm.NumSeqs = numSeqs
+	if stats != nil {
+		for _, kind := range []string{"MSV", "VITERBI", "FORWARD"} {
+			if pair, ok := stats[kind]; !ok || pair[1] <= 0 {
+				return nil, fmt.Errorf("hmmer3 model %s: STATS LOCAL %s is missing or has no positive lambda", name, kind)
+			}
+		}
+		hmm.HMMERStats = &HMMERStats{
+			MSVMu: stats["MSV"][0], MSVLambda: stats["MSV"][1],
+			ViterbiMu: stats["VITERBI"][0], ViterbiLambda: stats["VITERBI"][1],
+			ForwardTau: stats["FORWARD"][0], ForwardLambda: stats["FORWARD"][1],
+		}
+	}
+	return hmm, nil
+}
+
+//setPlan7Transitions puts the seven transitions of node k into the transition
+//map. In node 0, m is Start; in the last node, m->m, i->m and d->m go to End and
+//m->d and d->d do not exist.
+func setPlan7Transitions(trmap MtxMap, k, numMatch int, trans []float64) {
+	name := func(kind string, k int) string {
+		switch {
+		case kind == "M" && k == 0:
+			return "Start"
+		case kind == "M" && k > numMatch:
+			return "End"
+		}
+		return kind + strconv.Itoa(k)
+	}
+	for t, pair := range hmmerTransitions {
+		next := k + 1
+		if pair[1] == "I" {
+			next = k
+		}
+		if (pair[0] == "D" && k == 0) || (pair[1] == "D" && next > numMatch) {
+			continue
+		}
+		trmap[name(pair[0], k)][name(pair[1], next)] = trans[t]
+	}
+}
@@ -0,0 +1,145 @@
+package profilehmm
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+//writeHMMER3 writes the model in HMMER3 format into a string.
+func writeHMMER3(t *testing.T, hmm *ProfileHMM) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := hmm.WriteHMMER3(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+//readHMMER3 reads the one model of a HMMER3 file held in a string.
+func readHMMER3(t *testing.T, file string) *ProfileHMM {
+	t.Helper()
+	hmms, err := ReadHMMER3(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hmms) != 1 {
+		t.Fatalf("read %d models, want 1", len(hmms))
+	}
+	return hmms[0]
+}
+
+//TestHMMER3RoundTrip writes the sample models in HMMER3 format and reads them
+//back. The emissions come back to the 5 decimals of their logs, and the
+//transitions as HMMER keeps them, without I->D and D->I. A model read from a
+//HMMER3 file is written again exactly as it was read.
+func TestHMMER3RoundTrip(t *testing.T) {
+	for _, seed := range sampleSeeds {
+		t.Run(seed.name, func(t *testing.T) {
+			hmm := buildSample(t, seed.name, seed.file)
+			hmm.Accession, hmm.Description, hmm.NumSeqs = "PF00000.1", "a sample domain", 55
+			file := writeHMMER3(t, hmm)
+			loaded := readHMMER3(t, file)
+
+			if loaded.Name != hmm.Name || loaded.Accession != hmm.Accession || loaded.Description != hmm.Description ||
+				loaded.NumSeqs != hmm.NumSeqs || loaded.Length != hmm.Length {
+				t.Errorf("header is %s %s %q %d %d", loaded.Name, loaded.Accession, loaded.Description, loaded.NumSeqs, loaded.Length)
+			}
+			for _, state := range hmm.States {
+				for _, letter := range hmm.Alphabet {
+					want, got := hmm.Emimap[state][letter], loaded.Emimap[state][letter]
+					if math.Abs(got-want) > 1e-5*want {
+						t.Errorf("emission %s -> %s is %g, want %g", state, letter, got, want)
+					}
+				}
+			}
+			want, got := plan7Transitions(hmm.Trmap, hmm.Length), plan7Transitions(loaded.Trmap, loaded.Length)
+			for k := range want {
+				for i := range want[k] {
+					if math.Abs(got[k][i]-want[k][i]) > 1e-5*want[k][i] {
+						t.Errorf("transition %s of node %d is %g, want %g", hmmerTransitions[i], k, got[k][i], want[k][i])
+					}
+				}
+			}
+			if losses := loaded.HMMERLosses(0); len(losses) > 0 {
+				t.Errorf("model read back has transitions HMMER does not: %v", losses)
+			}
+			if problems := ValidateMaps(loaded.Alphabet, loaded.States, loaded.Trmap, loaded.Emimap); len(problems) > 0 {
+				t.Errorf("model read back is not valid: %v", problems)
+			}
+
+			again := writeHMMER3(t, loaded)
+			if writeHMMER3(t, readHMMER3(t, again)) != again {
+				t.Error("a model read from a HMMER3 file is not written back the same")
+			}
+		})
+	}
+}
+
+//TestHMMER3Stats checks that the STATS lines of a HMMER3 file are kept apart
+//from the calibration, so that search does not use them for its E-values, and
+//written back as they were; and that our calibration is not written as STATS.
+func TestHMMER3Stats(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	hmm.Calibration = &Calibration{Mode: Local, MultiDomain: true, ViterbiMu: -8.5, ViterbiLambda: 0.69, ForwardTau: -4.1, ForwardLambda: 0.69}
+	if file := writeHMMER3(t, hmm); strings.Contains(file, "STATS") {
+		t.Error("our calibration was written as HMMER STATS lines")
+	}
+
+	hmm.Calibration = nil
+	hmm.HMMERStats = &HMMERStats{-9.9012, 0.71234, -10.4321, 0.71234, -4.5678, 0.71234}
+	file := writeHMMER3(t, hmm)
+	for _, line := range []string{
+		"STATS LOCAL MSV       -9.9012  0.71234",
+		"STATS LOCAL VITERBI  -10.4321  0.71234",
+		"STATS LOCAL FORWARD   -4.5678  0.71234",
+	} {
+		if !strings.Contains(file, line+"\n") {
+			t.Errorf("file has no line %q", line)
+		}
+	}
+	loaded := readHMMER3(t, file)
+	if loaded.Calibration != nil {
+		t.Errorf("STATS were read as the calibration %+v", loaded.Calibration)
+	}
+	if loaded.HMMERStats == nil || *loaded.HMMERStats != *hmm.HMMERStats {
+		t.Errorf("STATS read are %+v, want %+v", loaded.HMMERStats, hmm.HMMERStats)
+	}
+	if pValue := loaded.pValue(Local, true, 10); pValue != math.Exp2(-10) {
+		t.Errorf("P-value of 10 bits is %g, want the uncalibrated bound %g", pValue, math.Exp2(-10))
+	}
+}
+
+//TestReadHMMER3Errors checks the files ReadHMMER3 refuses.
+func TestReadHMMER3Errors(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	hmm.HMMERStats = &HMMERStats{-9.9, 0.71, -10.4, 0.71, -4.5, 0.71}
+	file := writeHMMER3(t, hmm)
+	tests := []struct {
+		name, file, wantErr string
+	}{
+		{"empty file", "", "no model found"},
+		{"not a HMMER3 file", "HMMER2.0\n", "expected a HMMER3 header line"},
+		{"no LENG", strings.Replace(file, "LENG", "XLEN", 1), "missing LENG line"},
+		{"DNA model", strings.Replace(file, "ALPH  amino", "ALPH  DNA", 1), "only amino models"},
+		{"STATS line missing", strings.Replace(file, "STATS LOCAL MSV", "XSTATS LOCAL MSV", 1), "STATS LOCAL MSV is missing"},
+		{"STATS value that is not a number", strings.Replace(file, "-10.4000", "-10.4x", 1), "bad STATS value"},
+		{"node out of order", strings.Replace(file, "\n      2 ", "\n      3 ", 1), "expected the match emissions of node 2"},
+		{"cut short", file[:len(file)/2], "file ends inside a model"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.file == file {
+				t.Fatal("the edit did not change the file")
+			}
+			_, err := ReadHMMER3(strings.NewReader(test.file))
+			if err == nil {
+				t.Fatal("ReadHMMER3 accepted the file")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error is %q, want it to mention %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,6 @@
 //This file contains small functions to help with the main function.
 
-package main
+package profilehmm
 
 import (
 	"fmt"
@@ -20,6 +20,21 @@ func LogLikeliHood(a, b float64) float64 {
 	return loglikelihood
 }
 
+//LogAdd takes two log probabilities ln(a) and ln(b) and returns ln(a+b) without
+//leaving log space, so that tiny probabilities do not underflow. log(0) is -Inf.
+func LogAdd(logA, logB float64) float64 {
+	if math.IsInf(logA, -1) {
+		return logB
+	}
+	if math.IsInf(logB, -1) {
+		return logA
+	}
+	if logA < logB {
+		logA, logB = logB, logA
+	}
+	return logA + math.Log1p(math.Exp(logB-logA))
+}
+
 //SumOfIntSlice takse a integer slice and return the sum
 func SumOfIntSlice(s []int) int {
 	sum := 0
@@ -0,0 +1,138 @@
+//This file sums up a profile HMM in a few numbers, to check a new model before
+//it is used, without reading through its matrices:
+//1. The consensus sequence, the residue each match state emits most. It is in
+//   upper case if the state emits it more than half the time, so the conserved
+//   columns stand out.
+//2. The relative entropy of each match state against the background of the
+//   null model (BackgroundProtein, as in NullEmiMapProtein, for proteins), in
+//   bits: sum over x of e(x) log2(e(x)/bg(x)). It is 0 for a column that emits
+//   like the background, and log2(1/bg(x)) (4.3 bits for a W) for a column that
+//   always emits the same rare residue. A model whose columns are all near 0
+//   has learned little from its alignment.
+//3. The expected length, the mean number of residues emitted by a path from
+//   Start to End. It is near the number of match states, and much more if the
+//   insert states loop too much.
+
+package profilehmm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//ModelSummary is the summary of a profile HMM. RelativeEntropy has the
+//relative entropy of match states 1 to Length, MeanEntropy is their mean, in
+//bits.
+type ModelSummary struct {
+	Name            string    `json:"name"`
+	Length          int       `json:"length"`
+	Consensus       string    `json:"consensus"`
+	RelativeEntropy []float64 `json:"relative_entropy"`
+	MeanEntropy     float64   `json:"mean_relative_entropy"`
+	ExpectedLength  float64   `json:"expected_length"`
+}
+
+//Summary returns the consensus, the relative entropy of each match state and
+//the expected length of the model.
+func (hmm *ProfileHMM) Summary() (*ModelSummary, error) {
+	expected, err := hmm.ExpectedLength()
+	if err != nil {
+		return nil, err
+	}
+	entropy := hmm.RelativeEntropy()
+	return &ModelSummary{
+		Name:            hmm.Name,
+		Length:          hmm.Length,
+		Consensus:       hmm.Consensus(),
+		RelativeEntropy: entropy,
+		MeanEntropy:     mean(entropy),
+		ExpectedLength:  expected,
+	}, nil
+}
+
+//Consensus returns the consensus sequence of the model, one residue per match
+//state, in lower case where the state emits it less than half the time.
+func (hmm *ProfileHMM) Consensus() string {
+	var consensus strings.Builder
+	for k := 1; k <= hmm.Length; k++ {
+		consensus.WriteString(hmm.consensusResidue(k))
+	}
+	return consensus.String()
+}
+
+//RelativeEntropy returns the relative entropy in bits of the emissions of each
+//match state 1 to Length against the null model.
+func (hmm *ProfileHMM) RelativeEntropy() []float64 {
+	entropy := make([]float64, hmm.Length)
+	for k := 1; k <= hmm.Length; k++ {
+		for letter, pr := range hmm.Emimap["M"+strconv.Itoa(k)] {
+			if bg := hmm.Null[letter]; pr > 0 && bg > 0 {
+				entropy[k-1] += pr * math.Log2(pr/bg)
+			}
+		}
+	}
+	return entropy
+}
+
+//ExpectedLength returns the mean number of residues emitted from Start to End.
+//Each state is visited, on average, the visits of the states it comes from
+//times their transition into it; a self loop of probability t makes it
+//1/(1-t) times as many. The states that come into a state are before it in the
+//header (see ProfileTopology), so one pass down the header is enough; the
+//expected length is the sum of the visits of the emitting states.
+func (hmm *ProfileHMM) ExpectedLength() (float64, error) {
+	if _, ok := ProfileLength(hmm.States); !ok {
+		return 0, errors.New("expected length needs the states of a profile HMM")
+	}
+	visits := make([]float64, len(hmm.States))
+	visits[0] = 1
+	length := 0.0
+	for v2 := 1; v2 < len(hmm.States); v2++ {
+		loop := 0.0
+		for i, v1 := range hmm.tr.From[v2] {
+			if v1 == v2 {
+				loop = hmm.tr.Prob[v2][i]
+			} else {
+				visits[v2] += visits[v1] * hmm.tr.Prob[v2][i]
+			}
+		}
+		if loop >= 1 {
+			if visits[v2] > 0 {
+				return 0, fmt.Errorf("state %s loops with probability 1, so the model never ends", hmm.States[v2])
+			}
+			continue
+		}
+		visits[v2] /= 1 - loop
+		if state := hmm.States[v2]; state[0] == 'M' || state[0] == 'I' {
+			length += visits[v2]
+		}
+	}
+	return length, nil
+}
+
+//WriteText writes the summary for people: the numbers of the whole model, then
+//one line per match state with its consensus residue and relative entropy, and
+//a bar of one "#" per quarter of a bit.
+func (summary *ModelSummary) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "# model:            %s\n", summary.Name)
+	fmt.Fprintf(w, "# match states:     %d\n", summary.Length)
+	fmt.Fprintf(w, "# expected length:  %.2f\n", summary.ExpectedLength)
+	fmt.Fprintf(w, "# mean entropy:     %.3f bits per match state\n", summary.MeanEntropy)
+	fmt.Fprintf(w, "# consensus:        %s\n#\n", summary.Consensus)
+	fmt.Fprintf(w, "%5s %4s %8s\n", "state", "cons", "bits")
+	for k, bits := range summary.RelativeEntropy {
+		fmt.Fprintf(w, "%5d %4s %8.3f  %s\n", k+1, summary.Consensus[k:k+1], bits, strings.Repeat("#", int(bits*4+0.5)))
+	}
+}
+
+//WriteJSON writes the summary as an indented JSON object.
+func (summary *ModelSummary) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
@@ -0,0 +1,34 @@
+package profilehmm
+
+import (
+	"math"
+	"testing"
+)
+
+//TestSummary checks the summary of the tiny model against the numbers worked
+//out by hand. The visits of the states are I0 0.2, M1 0.9, D1 0.1, I1 0.18,
+//M2 0.95, D2 0.05, I2 0.19, M3 0.81, D3 0.19 and I3 0.324 (End is visited
+//once), so the emitting states give an expected length of 3.554.
+func TestSummary(t *testing.T) {
+	hmm := tinyProfileHMM(t)
+	summary, err := hmm.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(summary.ExpectedLength-3.554) > 1e-9 {
+		t.Errorf("expected length is %g, want 3.554", summary.ExpectedLength)
+	}
+	if summary.Consensus != "CrG" {
+		t.Errorf("consensus is %q, want \"CrG\"", summary.Consensus)
+	}
+	if want := math.Log2(1 / hmm.Null["G"]); math.Abs(summary.RelativeEntropy[2]-want) > 1e-9 {
+		t.Errorf("relative entropy of M3 is %g, want %g", summary.RelativeEntropy[2], want)
+	}
+
+	//an insert state that never leaves makes the length infinite.
+	hmm.Trmap["I1"]["I1"], hmm.Trmap["I1"]["M2"] = 1, 0
+	hmm.Compile()
+	if _, err := hmm.ExpectedLength(); err == nil {
+		t.Error("no error for an insert state that loops with probability 1")
+	}
+}
@@ -0,0 +1,190 @@
+//This file checks that a transition map and an emission map make a sound
+//profile HMM before it is used. A corrupted or mismatched model does not make
+//the algorithms fail; they just give nonsense paths and scores, so the loaders
+//(LoadProfileHMM, ReadJSON, ReadHMMER3) run ValidateMaps and refuse bad models.
+
+package profilehmm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+//StochasticTolerance is how far from 1 the sum of a row may be. It is loose
+//enough for map files rounded to 4 decimals, like those of the sample data,
+//where a row of 20 emissions may be off by up to 0.001.
+const StochasticTolerance = 0.02
+
+//ValidationError is returned by the loaders when ValidateMaps finds problems.
+type ValidationError struct {
+	Problems []error
+}
+
+//Error gives the first problem and how many more there are.
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid model: " + e.Problems[0].Error()
+	}
+	return fmt.Sprintf("invalid model: %v (and %d more problems)", e.Problems[0], len(e.Problems)-1)
+}
+
+//Validate checks the maps of the model with ValidateMaps.
+func (hmm *ProfileHMM) Validate() []error {
+	return ValidateMaps(hmm.Alphabet, hmm.States, hmm.Trmap, hmm.Emimap)
+}
+
+//validateOrFail returns a ValidationError if ValidateMaps finds problems.
+func validateOrFail(sigma, states []string, trmap, emimap MtxMap) error {
+	if problems := ValidateMaps(sigma, states, trmap, emimap); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+//ValidateMaps returns every problem it finds in the maps of a profile HMM:
+//1. states that are not the header made by MakeMapHeader, and states or symbols
+//   missing from one map or not belonging to the other (header mismatches);
+//2. negative, infinite, NaN or bigger than 1 values;
+//3. transitions that the profile topology does not allow (see ProfileTopology);
+//4. rows that are not stochastic: the transitions out of each state and the
+//   emissions of M and I states need to sum to 1, while End has no transitions
+//   and Start, D and End emit nothing. A state that can not be reached (no
+//   transition goes into it) may have a row of zeros, as an alignment without
+//   pseudocounts gives.
+//It returns nil for a sound model.
+func ValidateMaps(sigma, states []string, trmap, emimap MtxMap) []error {
+	var problems []error
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, a...))
+	}
+	if len(states) == 0 || len(sigma) == 0 {
+		report("the model has no states or no sigma")
+		return problems
+	}
+
+	//header mismatches
+	isState := make(map[string]bool, len(states))
+	for _, state := range states {
+		isState[state] = true
+	}
+	inSigma := make(map[string]bool, len(sigma))
+	for _, letter := range sigma {
+		inSigma[letter] = true
+	}
+	for _, state := range states {
+		if _, ok := trmap[state]; !ok {
+			report("state %s has no row in the transition map", state)
+		}
+		if _, ok := emimap[state]; !ok {
+			report("state %s has no row in the emission map", state)
+		}
+	}
+	for _, pair := range []struct {
+		name string
+		mtx  MtxMap
+		cols map[string]bool
+		kind string
+	}{{"transition", trmap, isState, "state"}, {"emission", emimap, inSigma, "symbol of sigma"}} {
+		for _, row := range sortedKeys(pair.mtx) {
+			if !isState[row] {
+				report("the %s map has a row %s which is not one of the states", pair.name, row)
+			}
+			for _, col := range sortedColumns(pair.mtx[row]) {
+				if !pair.cols[col] {
+					report("the %s map has a column %s which is not a %s", pair.name, col, pair.kind)
+				}
+			}
+		}
+	}
+	numMatch, isProfile := ProfileLength(states)
+	if !isProfile {
+		report("the states are not those of a profile HMM (Start, I0, M1, D1, I1, ..., End)")
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	//values
+	for _, pair := range []struct {
+		name string
+		mtx  MtxMap
+		cols []string
+	}{{"transition", trmap, states}, {"emission", emimap, sigma}} {
+		for _, row := range states {
+			for _, col := range pair.cols {
+				if value := pair.mtx[row][col]; math.IsNaN(value) || math.IsInf(value, 0) || value < 0 || value > 1 {
+					report("%s %s -> %s is %g, not a probability", pair.name, row, col, value)
+				}
+			}
+		}
+	}
+
+	//topology
+	from := ProfileTopology(states)
+	reachable := make(map[string]bool, len(states))
+	reachable["Start"] = true
+	for v2, state := range states {
+		allowed := make(map[string]bool, len(from[v2]))
+		for _, v1 := range from[v2] {
+			allowed[states[v1]] = true
+		}
+		for _, prev := range states {
+			if trmap[prev][state] == 0 {
+				continue
+			}
+			if !allowed[prev] {
+				report("illegal transition %s -> %s in a profile HMM of length %d", prev, state, numMatch)
+			} else if prev != state {
+				reachable[state] = true
+			}
+		}
+	}
+
+	//rows
+	for _, state := range states {
+		trSum, emiSum := 0.0, 0.0
+		for _, value := range trmap[state] {
+			trSum += value
+		}
+		for _, value := range emimap[state] {
+			emiSum += value
+		}
+		silent := isHiddenState(state)
+		switch {
+		case state == "End" && trSum != 0:
+			report("End has transitions out of it (sum %g)", trSum)
+		case state != "End" && !(trSum == 0 && !reachable[state]) && math.Abs(trSum-1) > StochasticTolerance:
+			report("transitions out of %s sum to %g, not 1", state, trSum)
+		}
+		switch {
+		case silent && emiSum != 0:
+			report("%s does not emit, but its emissions sum to %g", state, emiSum)
+		case !silent && !(emiSum == 0 && !reachable[state]) && math.Abs(emiSum-1) > StochasticTolerance:
+			report("emissions of %s sum to %g, not 1", state, emiSum)
+		}
+	}
+	return problems
+}
+
+//sortedKeys returns the row names of the map in sorted order, so problems are
+//reported in the same order every time.
+func sortedKeys(mtx MtxMap) []string {
+	keys := make([]string, 0, len(mtx))
+	for key := range mtx {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//sortedColumns returns the column names of a row in sorted order, for the same
+//reason.
+func sortedColumns(row map[string]float64) []string {
+	keys := make([]string, 0, len(row))
+	for key := range row {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+package profilehmm
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//copyMap returns a copy of the map that can be changed without changing it.
+func copyMap(mtx MtxMap) MtxMap {
+	out := make(MtxMap, len(mtx))
+	for row := range mtx {
+		out[row] = make(map[string]float64, len(mtx[row]))
+		for col, value := range mtx[row] {
+			out[row][col] = value
+		}
+	}
+	return out
+}
+
+//TestValidateMaps breaks the SH3 sample model in one way for each kind of
+//problem, and checks that ValidateMaps reports exactly those problems, in
+//order. Each wanted problem is a part of the message, since sums are written
+//with all their digits.
+func TestValidateMaps(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+
+	tests := []struct {
+		name   string
+		sigma  []string
+		mutate func(trmap, emimap MtxMap) (states []string)
+		want   []string
+	}{
+		{"sound model", nil, func(trmap, emimap MtxMap) []string {
+			return hmm.States
+		}, nil},
+		{"row off within the tolerance", nil, func(trmap, emimap MtxMap) []string {
+			emimap["M3"]["A"] += StochasticTolerance / 2
+			return hmm.States
+		}, nil},
+		{"emission row off by more than the tolerance", nil, func(trmap, emimap MtxMap) []string {
+			emimap["M3"]["A"] += 0.05
+			return hmm.States
+		}, []string{"emissions of M3 sum to"}},
+		{"transition row off by more than the tolerance", nil, func(trmap, emimap MtxMap) []string {
+			trmap["M2"]["M3"] -= 0.05
+			return hmm.States
+		}, []string{"transitions out of M2 sum to"}},
+		{"silent state emits", nil, func(trmap, emimap MtxMap) []string {
+			emimap["D2"]["W"] = 0.5
+			return hmm.States
+		}, []string{"D2 does not emit"}},
+		{"value out of range", nil, func(trmap, emimap MtxMap) []string {
+			emimap["M1"]["A"] = -0.1
+			return hmm.States
+		}, []string{"emission M1 -> A is -0.1", "emissions of M1 sum to"}},
+		{"illegal transition", nil, func(trmap, emimap MtxMap) []string {
+			trmap["M1"]["M2"] -= 0.1
+			trmap["M1"]["M3"] = 0.1
+			return hmm.States
+		}, []string{"illegal transition M1 -> M3"}},
+		{"missing rows", nil, func(trmap, emimap MtxMap) []string {
+			delete(emimap, "M4")
+			delete(trmap, "I2")
+			return hmm.States
+		}, []string{"state I2 has no row in the transition map", "state M4 has no row in the emission map"}},
+		{"unknown states", nil, func(trmap, emimap MtxMap) []string {
+			trmap["X9"] = map[string]float64{"M1": 1}
+			trmap["M1"]["Q7"] = 0
+			return hmm.States
+		}, []string{"column Q7 which is not a state", "row X9 which is not one of the states"}},
+		{"symbols outside sigma, in sorted order", nil, func(trmap, emimap MtxMap) []string {
+			emimap["M2"]["Z"] = 0
+			emimap["M2"]["B"] = 0
+			emimap["I1"]["X"] = 0
+			return hmm.States
+		}, []string{"column X which is not a symbol", "column B which is not a symbol", "column Z which is not a symbol"}},
+		{"no sigma", []string{}, func(trmap, emimap MtxMap) []string {
+			return hmm.States
+		}, []string{"no states or no sigma"}},
+		{"states not of a profile HMM", nil, func(trmap, emimap MtxMap) []string {
+			states := append([]string{}, hmm.States...)
+			states[2], states[3] = states[3], states[2] //D1 before M1
+			return states
+		}, []string{"not those of a profile HMM"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trmap, emimap := copyMap(hmm.Trmap), copyMap(hmm.Emimap)
+			states := test.mutate(trmap, emimap)
+			sigma := test.sigma
+			if sigma == nil {
+				sigma = hmm.Alphabet
+			}
+			problems := ValidateMaps(sigma, states, trmap, emimap)
+			for i := 0; i < len(problems) || i < len(test.want); i++ {
+				switch {
+				case i >= len(problems):
+					t.Errorf("problem %d: missing, want %q", i+1, test.want[i])
+				case i >= len(test.want):
+					t.Errorf("problem %d: unexpected %q", i+1, problems[i])
+				case !strings.Contains(problems[i].Error(), test.want[i]):
+					t.Errorf("problem %d: %q, want %q", i+1, problems[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+//TestValidateMapsOrder checks that the report is the same every time, since
+//the maps are iterated in a random order.
+func TestValidateMapsOrder(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	emimap := copyMap(hmm.Emimap)
+	for _, letter := range []string{"B", "J", "O", "U", "X", "Z"} {
+		emimap["M1"][letter] = 0
+		emimap["I3"][letter] = 0
+	}
+	first := ValidateMaps(hmm.Alphabet, hmm.States, hmm.Trmap, emimap)
+	if len(first) != 12 {
+		t.Fatalf("got %d problems, want 12", len(first))
+	}
+	if !strings.Contains(first[0].Error(), "column B") || !strings.Contains(first[11].Error(), "column Z") {
+		t.Errorf("problems are not sorted by row and column: %v", first)
+	}
+	for run := 0; run < 20; run++ {
+		again := ValidateMaps(hmm.Alphabet, hmm.States, hmm.Trmap, emimap)
+		for i := range first {
+			if again[i].Error() != first[i].Error() {
+				t.Fatalf("run %d: problem %d is %q, was %q", run, i+1, again[i], first[i])
+			}
+		}
+	}
+}
+
+//TestLoadRefusesInvalidMaps checks that LoadProfileHMM returns a
+//ValidationError with every problem of map files that were changed by hand.
+func TestLoadRefusesInvalidMaps(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	hmm.Emimap = copyMap(hmm.Emimap)
+	hmm.Emimap["M2"]["W"] += 0.5
+	hmm.Emimap["M5"]["W"] += 0.5
+	dir := t.TempDir()
+	trName, emiName := filepath.Join(dir, "TrMap.txt"), filepath.Join(dir, "EmiMap.txt")
+	if err := hmm.Save(trName, emiName); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadProfileHMM("SH3", trName, emiName)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("error is %v, want a *ValidationError", err)
+	}
+	if len(invalid.Problems) != 2 {
+		t.Errorf("got problems %v, want those of M2 and M5", invalid.Problems)
+	}
+}
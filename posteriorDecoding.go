@@ -0,0 +1,169 @@
+//This file contains posterior decoding. Viterbi gives one most probable path,
+//but does not tell how sure we are about each step of it. With the forward and
+//backward matrices we can compute, for each symbol of the string, the probability
+//that it was emitted by each state, summed over all paths. From those we also
+//build the maximum expected accuracy (MEA) alignment: the path through the HMM
+//that has the highest sum of posterior probabilities of its emissions.
+
+package profilehmm
+
+import (
+	"errors"
+	"math"
+)
+
+//Posterior is the result of posterior decoding of a string.
+//Prob[i][v] is the probability that symbol i of the string was emitted by state
+//v (an index of States); it is 0 for states that do not emit. LogPr is the log
+//probability of the string given by Forward.
+type Posterior struct {
+	States []string
+	Prob   [][]float64
+	LogPr  float64
+}
+
+//PosteriorDecoding takes the same input as ViterbiDecoding and returns the
+//posterior probability of each state emitting each symbol of the string.
+func PosteriorDecoding(startpoint int, str string, sigma, states []string, trmap, emimap MtxMap) (*Posterior, error) {
+	tr := NewTransitions(MapToDense(states, states, trmap))
+	emi := MapToDense(states, sigma, emimap)
+	return PosteriorDecodingIndexed(startpoint, emi.Encode(str), tr, emi)
+}
+
+//PosteriorDecodingIndexed is PosteriorDecoding on the sparse transitions and the
+//dense emission matrix. Each posterior is forward + backward - ln Pr(x), taken
+//out of log space.
+func PosteriorDecodingIndexed(startpoint int, seq []int, tr *Transitions, emi *DenseMtx) (*Posterior, error) {
+	if len(seq) == 0 {
+		return nil, errors.New("can't decode a string of length 0")
+	}
+	var forwardMtx, backwardMtx [][]float64
+	var logPr float64
+	shift := 0 //column of the forward and backward matrices right after symbol i is emitted is i+shift.
+
+	if startpoint == 1 {
+		forwardMtx = FillForwardWithHiddenStates(seq, tr, emi)
+		backwardMtx = FillBackwardWithHiddenStates(seq, tr, emi)
+		logPr = forwardMtx[len(forwardMtx)-1][len(seq)]
+		shift = 1
+	} else {
+		forwardMtx = FillForwardNoHiddenStates(seq, tr, emi)
+		backwardMtx = FillBackwardNoHiddenStates(seq, tr, emi)
+		logPr = math.Inf(-1)
+		for f := range forwardMtx {
+			logPr = LogAdd(logPr, forwardMtx[f][len(seq)-1])
+		}
+	}
+	if math.IsInf(logPr, -1) {
+		return nil, errors.New("the string can not be emitted by the HMM")
+	}
+
+	post := &Posterior{States: tr.States, Prob: make([][]float64, len(seq)), LogPr: logPr}
+	for i := range seq {
+		post.Prob[i] = make([]float64, len(tr.States))
+		for v := range tr.States {
+			if startpoint == 1 && (tr.States[v][0:1] == "D" || tr.States[v][0:1] == "E" || v == 0) {
+				continue
+			}
+			post.Prob[i][v] = math.Exp(forwardMtx[v][i+shift] + backwardMtx[v][i+shift] - logPr)
+		}
+	}
+	return post, nil
+}
+
+//Best returns the state most likely to have emitted symbol i, and its posterior probability.
+func (post *Posterior) Best(i int) (string, float64) {
+	best := 0
+	for v, pr := range post.Prob[i] {
+		if pr > post.Prob[i][best] {
+			best = v
+		}
+	}
+	return post.States[best], post.Prob[i][best]
+}
+
+//MEADecoding returns the maximum expected accuracy path of the string through
+//the HMM, written like the path of ViterbiDecoding, and the expected number of
+//symbols it aligns correctly (the sum of the posteriors along the path).
+//It fills a matrix like FillViterbiWithHiddenStates, except that the score of an
+//emission is its posterior probability and transitions only need to be allowed.
+func MEADecoding(startpoint int, tr *Transitions, post *Posterior) (string, float64) {
+	states := tr.States
+	length := len(post.Prob)
+	var mea [][]float64
+	var backtrace [][]coordinate
+	var gain, max float64
+	var from coordinate
+
+	if startpoint == 1 {
+		mea, backtrace = newDPMatrix(len(states), length+1)
+		mea[0][0] = 0
+		for s := 0; s <= length; s++ {
+			for v2 := 1; v2 < len(states); v2++ {
+				max = math.Inf(-1)
+				from = coordinate{x: -1}
+				if states[v2][0:1] == "D" || states[v2][0:1] == "E" {
+					for _, v1 := range tr.From[v2] {
+						if mea[v1][s] > max {
+							max = mea[v1][s]
+							from = coordinate{v1, s}
+						}
+					}
+				} else if s > 0 && post.Prob[s-1][v2] > 0 {
+					gain = post.Prob[s-1][v2]
+					for _, v1 := range tr.From[v2] {
+						if mea[v1][s-1]+gain > max {
+							max = mea[v1][s-1] + gain
+							from = coordinate{v1, s - 1}
+						}
+					}
+				}
+				mea[v2][s] = max
+				backtrace[v2][s] = from
+			}
+		}
+	} else {
+		mea, backtrace = newDPMatrix(len(states), length)
+		for v := range states {
+			if post.Prob[0][v] > 0 {
+				mea[v][0] = post.Prob[0][v]
+			}
+		}
+		for s := 1; s < length; s++ {
+			for v2 := range states {
+				if post.Prob[s][v2] == 0 {
+					continue
+				}
+				max = math.Inf(-1)
+				from = coordinate{x: -1}
+				for _, v1 := range tr.From[v2] {
+					if mea[v1][s-1]+post.Prob[s][v2] > max {
+						max = mea[v1][s-1] + post.Prob[s][v2]
+						from = coordinate{v1, s - 1}
+					}
+				}
+				mea[v2][s] = max
+				backtrace[v2][s] = from
+			}
+		}
+	}
+
+	endingState := EndingInViterbi(startpoint, mea)
+	return ViterbiTraceBack(endingState, states, backtrace), mea[endingState.x][endingState.y]
+}
+
+//newDPMatrix makes a matrix of -Inf and a backtrace matrix without predecessors,
+//of the given number of states and columns.
+func newDPMatrix(numStates, numCols int) ([][]float64, [][]coordinate) {
+	mtx := make([][]float64, numStates)
+	backtrace := make([][]coordinate, numStates)
+	for v := range mtx {
+		mtx[v] = make([]float64, numCols)
+		backtrace[v] = make([]coordinate, numCols)
+		for s := range mtx[v] {
+			mtx[v][s] = math.Inf(-1)
+			backtrace[v][s].x = -1
+		}
+	}
+	return mtx, backtrace
+}
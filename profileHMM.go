@@ -3,15 +3,32 @@
 //access of values. A map of map is also easier than matrix to add or delete
 //values in case that we need to enlarge or shrink our number of states.
 
-package main
+//Package profilehmm builds profile hidden Markov models of protein domains from
+//multiple alignments, and uses them to score, align and generate sequences.
+//Failures are reported as error values; nothing in the package panics on bad input.
+package profilehmm
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
 	"time"
 )
 
 type MtxMap map[string]map[string]float64
 
+//Amino is the default sigma: the 20 amino acids that a protein domain emits.
+var Amino = []string{"G", "A", "L", "M", "F", "W", "K", "Q", "E", "S", "P", "V", "I", "C", "Y", "H", "R", "N", "D", "T"}
+
+//DefaultTheta is the fraction of gaps above which a column of the alignment is
+//an insertion column. It is an arbitrary value: training (BaumWelch and
+//ViterbiTraining) improves the maps afterwards, but not the choice of columns.
+//DefaultPseudoCount is the pseudocount added to transitions and emissions.
+const (
+	DefaultTheta       = 0.4
+	DefaultPseudoCount = 0.01
+)
+
 //Input: A threshold θ, followed by Σ, followed by a multiple alignment.
 //theta indicates whether we should determine the state at that position as deletion
 //according to how many real symbols we found at that specific position.
@@ -19,14 +36,29 @@ type MtxMap map[string]map[string]float64
 //do count pseudocount. Sigma is the emitted symbols such as amino acid. multiAlign
 //is the incoming aligned data tha we are using to construct our transition and emission maps.
 //Output: The transition and emission probabilities of the profile HMM HMM(Alignment, θ).
-func ProfileHMM(theta, pseudoCount float64, sigma, multiAlign []string) (MapHeader []string, trmap, emimap MtxMap) {
-	if len(multiAlign) == 0 || len(multiAlign[0]) == 0 {
-		panic("Invalid training data. Failed to construct ProfileHMM.")
+//It returns an error if the alignments are empty or not all of the same length.
+//BuildProfileHMM wraps the result into a ProfileHMM.
+func ProfileMaps(theta, pseudoCount float64, sigma, multiAlign []string) (MapHeader []string, trmap, emimap MtxMap, err error) {
+	if err = checkAlignments(multiAlign); err != nil {
+		return nil, nil, nil, err
 	}
-
 	md := MarkDeletionState(theta, multiAlign) //slice of integers {0,1} mark match or deletion state
-	alignSize := SumOfIntSlice(md)             //int
-	MapHeader = MakeMapHeader(alignSize)       //[]string
+	return ProfileMapsWithColumns(md, pseudoCount, sigma, multiAlign)
+}
+
+//ProfileMapsWithColumns is ProfileMaps when it is already known which columns
+//of the alignment are match columns: md has a 1 for each match column and a 0
+//for each insertion column, like MarkDeletionState returns.
+func ProfileMapsWithColumns(md []int, pseudoCount float64, sigma, multiAlign []string) (MapHeader []string, trmap, emimap MtxMap, err error) {
+	if err = checkAlignments(multiAlign); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(md) != len(multiAlign[0]) {
+		return nil, nil, nil, fmt.Errorf("%d columns are marked but the alignments have %d", len(md), len(multiAlign[0]))
+	}
+
+	alignSize := SumOfIntSlice(md)       //int
+	MapHeader = MakeMapHeader(alignSize) //[]string
 	eachLength := len(multiAlign[0])
 
 	trmap = ProfileTrMap(multiAlign, MapHeader, eachLength, md)
@@ -38,11 +70,24 @@ func ProfileHMM(theta, pseudoCount float64, sigma, multiAlign []string) (MapHead
 		emimapWithPseudo := EmimapPseudoCount(pseudoCount, emimap)
 		(&trmapWithPseudo).Normalize()
 		(&emimapWithPseudo).Normalize()
-		return MapHeader, trmapWithPseudo, emimap
+		return MapHeader, trmapWithPseudo, emimapWithPseudo, nil
 	}
 	return
 }
 
+//checkAlignments returns an error if the alignments are empty or not all of the same length.
+func checkAlignments(multiAlign []string) error {
+	if len(multiAlign) == 0 || len(multiAlign[0]) == 0 {
+		return errors.New("invalid training data, failed to construct profile HMM")
+	}
+	for i, align := range multiAlign {
+		if len(align) != len(multiAlign[0]) {
+			return fmt.Errorf("alignment %d has length %d, expected %d", i+1, len(align), len(multiAlign[0]))
+		}
+	}
+	return nil
+}
+
 //Normalize takes a map such as transition map and emission map, collect the sum
 //of each row and divide each value of the row to that sum, thus normalize all values (sum of each row adds to 1).
 func (anymap *MtxMap) Normalize() { // map[string]map[string]float64
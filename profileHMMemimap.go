@@ -1,4 +1,4 @@
-package main
+package profilehmm
 
 import (
 	"fmt"
@@ -31,24 +31,23 @@ func EmimapRaw(multiAlign, sigma, MapHeader []string, eachLength int, md []int)
 		totalVisits[h] = 0.0
 	}
 	//totalVisits := make([]int, len(md))
-	var curr string
+	//Deletion states do not emit, so a dash is not counted as an emission. Symbols
+	//that are not in sigma (such as X for an unknown amino acid) are skipped too.
+	var curr, letter string
 	for s := 0; s < eachLength; s++ {
 		for t := range multiAlign {
-
+			letter = multiAlign[t][s : s+1]
+			if letter == "-" {
+				continue
+			}
 			if md[s] == 1 {
-				if multiAlign[t][s:s+1] != "-" {
-					curr = "M" + fmt.Sprintf("%d", SumOfIntSlice(md[0:s+1]))
-				} else {
-					curr = "D" + fmt.Sprintf("%d", SumOfIntSlice(md[0:s+1]))
-				}
-				emimapRaw[curr][multiAlign[t][s:s+1]] += 1.0
+				curr = "M" + fmt.Sprintf("%d", SumOfIntSlice(md[0:s+1]))
+			} else {
+				curr = "I" + fmt.Sprintf("%d", SumOfIntSlice(md[0:s+1]))
+			}
+			if _, ok := emimapRaw[curr][letter]; ok {
+				emimapRaw[curr][letter] += 1.0
 				totalVisits[curr] += 1
-			} else if md[s] == 0 {
-				if multiAlign[t][s:s+1] != "-" {
-					curr = "I" + fmt.Sprintf("%d", SumOfIntSlice(md[0:s+1]))
-					emimapRaw[curr][multiAlign[t][s:s+1]] += 1.0
-					totalVisits[curr] += 1
-				}
 			}
 		}
 	}
@@ -0,0 +1,225 @@
+//This file reads and writes a profile HMM as one JSON file. Unlike the pair of
+//map files written by Save, the JSON file keeps the transitions, emissions, null
+//model, states and sigma of the model together with how it was built, so a
+//transition map can not be used with the emission map of another family. The
+//file has a format version, and a SHA-256 checksum of its content that is
+//checked when it is read, to catch files that were cut short or edited by hand.
+
+package profilehmm
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+//JSONFormat and JSONVersion are written in the "format" and "version" fields of
+//the JSON model file. ReadJSON refuses files of a newer version. Version 2 added
+//the calibration, version 3 the STATS lines of models read from HMMER3 files.
+const (
+	JSONFormat  = "profilehmm-model"
+	JSONVersion = 3
+)
+
+//jsonModel is the layout of the JSON model file. Transitions and emissions are
+//written as maps from state to symbol (or next state), leaving out the zeros.
+type jsonModel struct {
+	Format   string `json:"format"`
+	Version  int    `json:"version"`
+	Checksum string `json:"checksum"`
+
+	Metadata jsonMetadata `json:"metadata"`
+
+	Alphabet    []string           `json:"alphabet"`
+	States      []string           `json:"states"`
+	Length      int                `json:"length"`
+	Transitions MtxMap             `json:"transitions"`
+	Emissions   MtxMap             `json:"emissions"`
+	Null        map[string]float64 `json:"null"`
+	Calibration *Calibration       `json:"calibration,omitempty"`
+	HMMERStats  *HMMERStats        `json:"hmmer_stats,omitempty"`
+}
+
+//jsonMetadata is how the model was built.
+type jsonMetadata struct {
+	Name        string  `json:"name"`
+	Accession   string  `json:"accession,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Source      string  `json:"source,omitempty"`
+	Theta       float64 `json:"theta"`
+	PseudoCount float64 `json:"pseudocount"`
+	NumSeqs     int     `json:"num_seqs"`
+	Created     string  `json:"created,omitempty"`
+}
+
+//SaveJSON writes the model into a JSON file with WriteJSON.
+func (hmm *ProfileHMM) SaveJSON(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := hmm.WriteJSON(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//WriteJSON writes the model as JSON, with the time it was written and its checksum.
+func (hmm *ProfileHMM) WriteJSON(w io.Writer) error {
+	model := &jsonModel{
+		Format:  JSONFormat,
+		Version: JSONVersion,
+		Metadata: jsonMetadata{
+			Name:        hmm.Name,
+			Accession:   hmm.Accession,
+			Description: hmm.Description,
+			Source:      hmm.Source,
+			Theta:       hmm.Theta,
+			PseudoCount: hmm.PseudoCount,
+			NumSeqs:     hmm.NumSeqs,
+			Created:     time.Now().UTC().Format(time.RFC3339),
+		},
+		Alphabet:    hmm.Alphabet,
+		States:      hmm.States,
+		Length:      hmm.Length,
+		Transitions: nonZero(hmm.Trmap),
+		Emissions:   nonZero(hmm.Emimap),
+		Null:        hmm.Null,
+		Calibration: hmm.Calibration,
+		HMMERStats:  hmm.HMMERStats,
+	}
+	checksum, err := model.checksum()
+	if err != nil {
+		return err
+	}
+	model.Checksum = checksum
+
+	data, err := json.MarshalIndent(model, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+//LoadJSON reads a model from a JSON file with ReadJSON.
+func LoadJSON(filename string) (*ProfileHMM, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hmm, err := ReadJSON(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return hmm, nil
+}
+
+//ReadJSON reads a model written by WriteJSON. It returns an error if the file
+//is not a model file, is of a newer version, does not match its checksum, or if
+//ValidateMaps finds problems in its maps.
+func ReadJSON(file io.Reader) (*ProfileHMM, error) {
+	var model jsonModel
+	if err := json.NewDecoder(file).Decode(&model); err != nil {
+		return nil, fmt.Errorf("json model: %v", err)
+	}
+	if model.Format != JSONFormat {
+		return nil, fmt.Errorf("json model: format is %q, expected %q", model.Format, JSONFormat)
+	}
+	if model.Version < 1 || model.Version > JSONVersion {
+		return nil, fmt.Errorf("json model: version %d is not supported (up to %d)", model.Version, JSONVersion)
+	}
+	checksum, err := model.checksum()
+	if err != nil {
+		return nil, err
+	}
+	if checksum != model.Checksum {
+		return nil, fmt.Errorf("json model: checksum is %s but the content sums to %s", model.Checksum, checksum)
+	}
+
+	//fill in the zeros that were left out, so that every state has its rows.
+	trmap := CreatEmptyMap(model.States, model.States)
+	emimap := CreatEmptyMap(model.States, model.Alphabet)
+	for _, pair := range [][2]MtxMap{{trmap, model.Transitions}, {emimap, model.Emissions}} {
+		for state, row := range pair[1] {
+			if _, ok := pair[0][state]; !ok {
+				return nil, fmt.Errorf("json model: %s is not one of the states", state)
+			}
+			for to, pr := range row {
+				pair[0][state][to] = pr
+			}
+		}
+	}
+	if err := validateOrFail(model.Alphabet, model.States, trmap, emimap); err != nil {
+		return nil, fmt.Errorf("json model: %w", err)
+	}
+	hmm, err := NewProfileHMM(model.Metadata.Name, model.Alphabet, model.States, trmap, emimap)
+	if err != nil {
+		return nil, fmt.Errorf("json model: %w", err)
+	}
+	if hmm.Length != model.Length {
+		return nil, fmt.Errorf("json model: length is %d but there are %d match states", model.Length, hmm.Length)
+	}
+	for _, letter := range model.Alphabet {
+		if _, ok := model.Null[letter]; !ok {
+			return nil, fmt.Errorf("json model: null model has no rate for %s", letter)
+		}
+	}
+	if model.Calibration != nil {
+		if err := model.Calibration.check(); err != nil {
+			return nil, fmt.Errorf("json model: %w", err)
+		}
+	}
+	hmm.Null = model.Null
+	hmm.Accession = model.Metadata.Accession
+	hmm.Description = model.Metadata.Description
+	hmm.Source = model.Metadata.Source
+	hmm.Theta = model.Metadata.Theta
+	hmm.PseudoCount = model.Metadata.PseudoCount
+	hmm.NumSeqs = model.Metadata.NumSeqs
+	hmm.Calibration = model.Calibration
+	hmm.HMMERStats = model.HMMERStats
+	hmm.Compile()
+	return hmm, nil
+}
+
+//checksum returns the SHA-256 of the model written as compact JSON with an
+//empty checksum field. Go writes the keys of maps in sorted order and floats
+//in their shortest exact form, so the same model always gives the same sum.
+func (model *jsonModel) checksum() (string, error) {
+	withoutSum := *model
+	withoutSum.Checksum = ""
+	data, err := json.Marshal(&withoutSum)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+//nonZero returns a copy of the map without the zero entries. Rows left empty
+//are kept, so every state is still listed.
+func nonZero(mtx MtxMap) MtxMap {
+	out := make(MtxMap, len(mtx))
+	for row := range mtx {
+		out[row] = make(map[string]float64)
+		for col, value := range mtx[row] {
+			if value != 0 {
+				out[row][col] = value
+			}
+		}
+	}
+	return out
+}
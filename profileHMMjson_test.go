@@ -0,0 +1,102 @@
+package profilehmm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//TestJSONRoundTrip writes the sample models with WriteJSON and checks that
+//ReadJSON gives back the same maps, null model and build parameters.
+func TestJSONRoundTrip(t *testing.T) {
+	for _, seed := range sampleSeeds {
+		t.Run(seed.name, func(t *testing.T) {
+			hmm := buildSample(t, seed.name, seed.file)
+			hmm.Source = seed.file
+			hmm.Calibration = &Calibration{Mode: Local, MultiDomain: true, ViterbiMu: -8.5, ViterbiLambda: 0.69, ForwardTau: -4.1, ForwardLambda: 0.69}
+			hmm.HMMERStats = &HMMERStats{-9.9, 0.71, -10.4, 0.71, -4.4, 0.71}
+			var buf bytes.Buffer
+			if err := hmm.WriteJSON(&buf); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := ReadJSON(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(loaded.Trmap, hmm.Trmap) {
+				t.Error("transition map changed in the round trip")
+			}
+			if !reflect.DeepEqual(loaded.Emimap, hmm.Emimap) {
+				t.Error("emission map changed in the round trip")
+			}
+			if !reflect.DeepEqual(loaded.Null, hmm.Null) {
+				t.Error("null model changed in the round trip")
+			}
+			if !reflect.DeepEqual(loaded.States, hmm.States) || !reflect.DeepEqual(loaded.Alphabet, hmm.Alphabet) {
+				t.Error("states or sigma changed in the round trip")
+			}
+			if !reflect.DeepEqual(loaded.Calibration, hmm.Calibration) {
+				t.Errorf("calibration is %+v, want %+v", loaded.Calibration, hmm.Calibration)
+			}
+			if !reflect.DeepEqual(loaded.HMMERStats, hmm.HMMERStats) {
+				t.Errorf("HMMER stats are %+v, want %+v", loaded.HMMERStats, hmm.HMMERStats)
+			}
+			if loaded.Name != hmm.Name || loaded.Source != hmm.Source || loaded.Theta != hmm.Theta ||
+				loaded.PseudoCount != hmm.PseudoCount || loaded.NumSeqs != hmm.NumSeqs {
+				t.Errorf("metadata changed in the round trip: %s %s %g %g %d", loaded.Name, loaded.Source, loaded.Theta, loaded.PseudoCount, loaded.NumSeqs)
+			}
+		})
+	}
+}
+
+//TestJSONRejectsChanges checks that ReadJSON refuses files edited after they
+//were written, cut short, or of another format or version.
+func TestJSONRejectsChanges(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	var buf bytes.Buffer
+	if err := hmm.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.String()
+
+	tests := []struct {
+		name    string
+		edit    func(string) string
+		wantErr string
+	}{
+		{"changed name", func(s string) string {
+			return strings.Replace(s, `"name": "SH3"`, `"name": "SH2"`, 1)
+		}, "checksum"},
+		{"changed theta", func(s string) string {
+			return strings.Replace(s, `"theta": 0.4`, `"theta": 0.5`, 1)
+		}, "checksum"},
+		{"changed checksum", func(s string) string {
+			return strings.Replace(s, `"checksum": "sha256:`, `"checksum": "sha256:0`, 1)
+		}, "checksum"},
+		{"cut short", func(s string) string {
+			return s[:len(s)/2]
+		}, "json model"},
+		{"other format", func(s string) string {
+			return strings.Replace(s, JSONFormat, "other-model", 1)
+		}, "format"},
+		{"newer version", func(s string) string {
+			return strings.Replace(s, `"version": 3`, `"version": 4`, 1)
+		}, "version 4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			edited := test.edit(file)
+			if edited == file {
+				t.Fatal("the edit did not change the file")
+			}
+			_, err := ReadJSON(strings.NewReader(edited))
+			if err == nil {
+				t.Fatal("ReadJSON accepted the edited file")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error is %q, want it to mention %q", err, test.wantErr)
+			}
+		})
+	}
+}
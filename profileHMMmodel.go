@@ -0,0 +1,268 @@
+//This file contains the ProfileHMM type. It keeps the states, sigma, transition
+//map and emission map of one domain family together, so that they can not get
+//out of sync when they are passed around, and puts the scoring, decoding and
+//sampling functions behind methods.
+
+package profilehmm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+//ProfileHMM is the profile HMM of one domain family.
+//Name is the code of the domain family, Alphabet is sigma (the emitted symbols),
+//Length is the number of match states and States is the map header made by
+//MakeMapHeader. Trmap and Emimap are the transition and emission maps, Null is
+//the background emission rate of each symbol used by the null model.
+//Accession and Description come with models read from HMMER3 files.
+//Source, Theta, PseudoCount and NumSeqs record how the model was built (Source
+//is the alignment or sequence file); they are zero when the model was read from
+//map files. Calibration is nil until Calibrate is run, or read from a JSON model
+//file. HMMERStats are the STATS lines of a model read from a HMMER3 file; they
+//are kept to be written back, but not used for E-values.
+type ProfileHMM struct {
+	Name        string
+	Accession   string
+	Description string
+	Alphabet    []string
+	Length      int
+	States      []string
+	Trmap       MtxMap
+	Emimap      MtxMap
+	Null        map[string]float64
+
+	Source      string
+	Theta       float64
+	PseudoCount float64
+	NumSeqs     int
+	Calibration *Calibration
+	HMMERStats  *HMMERStats
+
+	tr, nullTr   *Transitions //sparse copies of Trmap and the null transitions made by Compile
+	emi, nullEmi *DenseMtx    //dense copies of Emimap and the null emissions
+}
+
+//NewProfileHMM puts the states, sigma, transition map and emission map together
+//into a ProfileHMM, with BackgroundProtein as the null model. It returns an
+//error if the maps do not belong to each other: every state needs a row in
+//both maps, and every emission needs to be one of sigma.
+func NewProfileHMM(name string, sigma, states []string, trmap, emimap MtxMap) (*ProfileHMM, error) {
+	if len(states) == 0 {
+		return nil, errors.New("profile HMM has no states")
+	}
+	if len(sigma) == 0 {
+		return nil, errors.New("profile HMM has no sigma")
+	}
+	if len(trmap) != len(states) {
+		return nil, fmt.Errorf("transition map has %d rows but %d states", len(trmap), len(states))
+	}
+	if len(emimap) != len(states) {
+		return nil, fmt.Errorf("emission map has %d rows but the transition map has %d states", len(emimap), len(states))
+	}
+
+	inSigma := make(map[string]bool, len(sigma))
+	for _, letter := range sigma {
+		inSigma[letter] = true
+	}
+	length := 0
+	for _, state := range states {
+		if _, ok := trmap[state]; !ok {
+			return nil, fmt.Errorf("state %s has no row in the transition map", state)
+		}
+		if _, ok := emimap[state]; !ok {
+			return nil, fmt.Errorf("state %s has no row in the emission map", state)
+		}
+		for letter := range emimap[state] {
+			if !inSigma[letter] {
+				return nil, fmt.Errorf("state %s emits %s which is not in sigma", state, letter)
+			}
+		}
+		if strings.HasPrefix(state, "M") {
+			length++
+		}
+	}
+
+	null := make(map[string]float64, len(sigma))
+	for _, letter := range sigma {
+		null[letter] = BackgroundProtein[letter]
+	}
+
+	hmm := &ProfileHMM{
+		Name:     name,
+		Alphabet: sigma,
+		Length:   length,
+		States:   states,
+		Trmap:    trmap,
+		Emimap:   emimap,
+		Null:     null,
+	}
+	hmm.Compile()
+	return hmm, nil
+}
+
+//Compile makes the indexed matrices of the model and its null model, which are
+//used by Score and Decode. They read the letters of DegenerateAmino too, weighted
+//by Null. NewProfileHMM calls it; call it again after changing Trmap, Emimap or
+//Null directly.
+func (hmm *ProfileHMM) Compile() {
+	nulltrmap, nullemimap := hmm.NullModel()
+	hmm.tr = NewTransitions(MapToDense(hmm.States, hmm.States, hmm.Trmap))
+	hmm.emi = MapToDense(hmm.States, hmm.Alphabet, hmm.Emimap)
+	hmm.emi.AddDegenerates(DegenerateAmino, hmm.Null)
+	hmm.nullTr = NewTransitions(MapToDense(hmm.States, hmm.States, nulltrmap))
+	hmm.nullEmi = MapToDense(hmm.States, hmm.Alphabet, nullemimap)
+	hmm.nullEmi.AddDegenerates(DegenerateAmino, hmm.Null)
+}
+
+//BuildProfileHMM builds the profile HMM of the domain family from the multiple
+//alignment with ProfileMaps, and records the build parameters in it.
+func BuildProfileHMM(name string, theta, pseudoCount float64, sigma, multiAlign []string) (*ProfileHMM, error) {
+	header, trmap, emimap, err := ProfileMaps(theta, pseudoCount, sigma, multiAlign)
+	if err != nil {
+		return nil, err
+	}
+	hmm, err := NewProfileHMM(name, sigma, header, trmap, emimap)
+	if err != nil {
+		return nil, err
+	}
+	hmm.Theta = theta
+	hmm.PseudoCount = pseudoCount
+	hmm.NumSeqs = len(multiAlign)
+	return hmm, nil
+}
+
+//BuildProfileHMMWithColumns builds the profile HMM like BuildProfileHMM, when it
+//is already known which columns are match columns (md has 1 for a match column
+//and 0 for an insertion column), for example from the #=GC RF line of a
+//Stockholm file. Theta is not used, so it is recorded as 0.
+func BuildProfileHMMWithColumns(name string, md []int, pseudoCount float64, sigma, multiAlign []string) (*ProfileHMM, error) {
+	header, trmap, emimap, err := ProfileMapsWithColumns(md, pseudoCount, sigma, multiAlign)
+	if err != nil {
+		return nil, err
+	}
+	hmm, err := NewProfileHMM(name, sigma, header, trmap, emimap)
+	if err != nil {
+		return nil, err
+	}
+	hmm.PseudoCount = pseudoCount
+	hmm.NumSeqs = len(multiAlign)
+	return hmm, nil
+}
+
+//LoadProfileHMM reads the transition and emission files written by Save (or
+//MapToFile, which rounds to 4 decimals) and returns the profile HMM. It fails if
+//the two files do not belong to the same model, or if ValidateMaps finds problems
+//in them; the error is then a *ValidationError listing them all.
+func LoadProfileHMM(name, trmapName, emimapName string) (*ProfileHMM, error) {
+	trmap, emimap, header, sigma, err := ReadMaps(trmapName, emimapName)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOrFail(sigma, header, trmap, emimap); err != nil {
+		return nil, fmt.Errorf("%s and %s: %w", trmapName, emimapName, err)
+	}
+	hmm, err := NewProfileHMM(name, sigma, header, trmap, emimap)
+	if err != nil {
+		return nil, fmt.Errorf("%s and %s: %w", trmapName, emimapName, err)
+	}
+	return hmm, nil
+}
+
+//Save writes the transition and emission maps into two files with
+//MapToFileExact, so that LoadProfileHMM gives back the same model.
+func (hmm *ProfileHMM) Save(trmapName, emimapName string) error {
+	if err := MapToFileExact(emimapName, hmm.States, hmm.Alphabet, hmm.Emimap); err != nil {
+		return err
+	}
+	return MapToFileExact(trmapName, hmm.States, hmm.States, hmm.Trmap)
+}
+
+//WriteView writes the transition and emission matrices rounded to 4 decimals,
+//one after the other with a blank line between them, for people to read.
+func (hmm *ProfileHMM) WriteView(w io.Writer) {
+	fmt.Fprintln(w, "Transition matrix of", hmm.Name)
+	WriteMap(w, hmm.States, hmm.States, hmm.Trmap)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Emission matrix of", hmm.Name)
+	WriteMap(w, hmm.States, hmm.Alphabet, hmm.Emimap)
+}
+
+//NullModel returns the transition and emission maps of the null model: the same
+//states with equal transitions to all the next states, and the background
+//emission rates.
+func (hmm *ProfileHMM) NullModel() (nulltrmap, nullemimap MtxMap) {
+	return NullTrMap(hmm.Trmap), NullEmiMap(hmm.Emimap, hmm.Null)
+}
+
+//HasHiddenStates tells if some states of the model do not emit anything, in
+//which case the paths start from "Start" and end in "End".
+func (hmm *ProfileHMM) HasHiddenStates() bool {
+	return NonEmissionStateExist(hmm.Emimap)
+}
+
+//startpoint is the integer used by ViterbiDecoding and PrHiddenPath: 1 if there
+//are hidden states, 0 otherwise.
+func (hmm *ProfileHMM) startpoint() int {
+	if hmm.HasHiddenStates() {
+		return 1
+	}
+	return 0
+}
+
+//Score returns the log likelihood of the sequence being emitted by the domain
+//family compare to the null model, ln Pr(x|profile) - ln Pr(x|null). If it's
+//bigger than 1, the sequence likely belongs to the domain family.
+func (hmm *ProfileHMM) Score(str string) (float64, error) {
+	if len(str) == 0 {
+		return 0, errors.New("can't score a string of length 0")
+	}
+	seq := hmm.emi.Encode(str)
+	startpoint := hmm.startpoint()
+
+	//Forward gives log probabilities, so the log likelihood is their difference.
+	Ha := ForwardIndexed(startpoint, seq, hmm.tr, hmm.emi)
+	if math.IsInf(Ha, -1) {
+		return 0, errors.New("the string can not be emitted by the HMM")
+	}
+	H0 := ForwardIndexed(startpoint, seq, hmm.nullTr, hmm.nullEmi)
+	return Ha - H0, nil
+}
+
+//Decode returns the most probable path of the sequence through the model and
+//the probablity of emitting this path from the transition map.
+func (hmm *ProfileHMM) Decode(str string) (path string, prPath float64, err error) {
+	startpoint := hmm.startpoint()
+	path, err = ViterbiDecodingIndexed(startpoint, hmm.emi.Encode(str), hmm.tr, hmm.emi)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, PrHiddenPath(startpoint, path, hmm.States, hmm.Trmap), nil
+}
+
+//Sample generates one fictional domain sequence from the model, together with
+//the path it was emitted along.
+func (hmm *ProfileHMM) Sample() (path []string, seq string) {
+	path = DomainPathGenerator(hmm.Trmap, hmm.States)
+	return path, DomainSeqGenerator(path, hmm.Alphabet, hmm.Emimap)
+}
+
+//Posterior returns the posterior probability of each state emitting each symbol
+//of the sequence, summed over all paths through the model.
+func (hmm *ProfileHMM) Posterior(str string) (*Posterior, error) {
+	return PosteriorDecodingIndexed(hmm.startpoint(), hmm.emi.Encode(str), hmm.tr, hmm.emi)
+}
+
+//DecodeMEA returns the maximum expected accuracy path of the sequence through the
+//model and the expected number of symbols it aligns correctly.
+func (hmm *ProfileHMM) DecodeMEA(str string) (path string, accuracy float64, err error) {
+	post, err := hmm.Posterior(str)
+	if err != nil {
+		return "", 0, err
+	}
+	path, accuracy = MEADecoding(hmm.startpoint(), hmm.tr, post)
+	return path, accuracy, nil
+}
@@ -0,0 +1,358 @@
+//This file contains the training of a profile HMM from unaligned sequences. The
+//profile built from the Pfam or BLAST alignment is only as good as the alignment;
+//with Baum-Welch (expectation maximization) we can improve the transition and
+//emission maps with new family members that are not aligned. The model is
+//either one built by ProfileMaps, or a flat model of a given length. Viterbi
+//training is the faster alternative: it aligns each sequence along its most
+//probable path and counts the transitions and emissions of those paths. Both
+//drop the Calibration and HMMERStats of the model, which were fitted to the
+//scores of its old maps.
+
+package profilehmm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+//TrainingStep is the report of one iteration of training. LogLikelihood is the
+//total log probability of the training sequences under the model before the
+//iteration re-estimated it (for Viterbi training, the total log probability of
+//their Viterbi paths), and Skipped is the number of sequences that the model can
+//not emit (for example because of letters outside sigma), which are left out.
+//Changed is the number of Viterbi paths that differ from the last iteration.
+type TrainingStep struct {
+	Iteration     int
+	LogLikelihood float64
+	Skipped       int
+	Changed       int
+}
+
+//FlatProfileHMM makes a profile HMM with the given number of match states that
+//does not know anything about the family yet, as a starting point of training.
+//Transitions favour moving along the match states, insertions and match states
+//emit the background rates, and the match emissions are shaken randomly (with
+//the seed) so that the match states can become different from each other.
+func FlatProfileHMM(name string, length int, sigma []string, seed int64) (*ProfileHMM, error) {
+	if length < 1 {
+		return nil, errors.New("a profile HMM needs at least one match state")
+	}
+	states := MakeMapHeader(length)
+	trmap := CreatEmptyMap(states, states)
+	emimap := CreatEmptyMap(states, sigma)
+
+	//rough transition rates between the kinds of states; Start acts like M, End like M.
+	flatTr := map[string]map[string]float64{
+		"M": {"M": 0.9, "I": 0.05, "D": 0.05},
+		"I": {"M": 0.5, "I": 0.4, "D": 0.1},
+		"D": {"M": 0.5, "I": 0.1, "D": 0.4},
+	}
+	kind := func(state string) string {
+		if state == "Start" || state == "End" {
+			return "M"
+		}
+		return state[0:1]
+	}
+	for v2, from := range ProfileTopology(states) {
+		for _, v1 := range from {
+			trmap[states[v1]][states[v2]] = flatTr[kind(states[v1])][kind(states[v2])]
+		}
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	for _, state := range states {
+		if kind(state) == "D" || state == "Start" || state == "End" {
+			continue
+		}
+		for _, letter := range sigma {
+			rate, ok := BackgroundProtein[letter]
+			if !ok {
+				rate = 1 / float64(len(sigma))
+			}
+			if state[0:1] == "M" {
+				rate *= 0.75 + 0.5*random.Float64()
+			}
+			emimap[state][letter] = rate
+		}
+	}
+	(&trmap).Normalize()
+	(&emimap).Normalize()
+
+	return NewProfileHMM(name, sigma, states, trmap, emimap)
+}
+
+//BaumWelch trains the model on the unaligned sequences. Each iteration computes,
+//with the forward and backward matrices, the expected number of times each
+//transition and emission is used, adds the pseudoCount to the transitions and
+//emissions allowed by the profile topology, and normalizes them into the new
+//transition and emission maps. It stops when the log likelihood improves by less
+//than tolerance, or after maxIter iterations, and returns the report of each one.
+func (hmm *ProfileHMM) BaumWelch(seqs []string, pseudoCount float64, maxIter int, tolerance float64) ([]TrainingStep, error) {
+	if _, ok := ProfileLength(hmm.States); !ok {
+		return nil, errors.New("only a profile HMM made by MakeMapHeader can be trained")
+	}
+	if len(seqs) == 0 {
+		return nil, errors.New("no training sequences")
+	}
+
+	var steps []TrainingStep
+	prevLogL := math.Inf(-1)
+	for iter := 1; iter <= maxIter; iter++ {
+		trCount := NewDenseMtx(hmm.States, hmm.States)
+		emiCount := NewDenseMtx(hmm.States, hmm.Alphabet)
+		step := TrainingStep{Iteration: iter}
+
+		for _, str := range seqs {
+			seq := hmm.emi.Encode(str)
+			forwardMtx := FillForwardWithHiddenStates(seq, hmm.tr, hmm.emi)
+			logPr := forwardMtx[len(forwardMtx)-1][len(seq)]
+			if len(seq) == 0 || math.IsInf(logPr, -1) {
+				step.Skipped++
+				continue
+			}
+			backwardMtx := FillBackwardWithHiddenStates(seq, hmm.tr, hmm.emi)
+			step.LogLikelihood += logPr
+			hmm.expectedCounts(seq, forwardMtx, backwardMtx, logPr, trCount, emiCount)
+		}
+		if step.Skipped == len(seqs) {
+			return steps, errors.New("the model can not emit any of the training sequences")
+		}
+
+		steps = append(steps, step)
+		hmm.reestimate(trCount, emiCount, pseudoCount)
+		if math.Abs(step.LogLikelihood-prevLogL) < tolerance {
+			break
+		}
+		prevLogL = step.LogLikelihood
+	}
+	return steps, nil
+}
+
+//ViterbiTraining trains the model on the unaligned sequences. Each iteration
+//aligns every sequence along its Viterbi path, writes the paths as a multiple
+//alignment, and builds the new transition and emission maps from it with the
+//same counting as ProfileMaps (TrmapRaw and EmimapRaw plus the pseudoCount). It
+//stops when no path changes, or after maxIter iterations, and returns the report
+//of each one.
+func (hmm *ProfileHMM) ViterbiTraining(seqs []string, pseudoCount float64, maxIter int) ([]TrainingStep, error) {
+	if _, ok := ProfileLength(hmm.States); !ok {
+		return nil, errors.New("only a profile HMM made by MakeMapHeader can be trained")
+	}
+	if len(seqs) == 0 {
+		return nil, errors.New("no training sequences")
+	}
+
+	var steps []TrainingStep
+	prevPaths := make([]string, len(seqs))
+	for iter := 1; iter <= maxIter; iter++ {
+		step := TrainingStep{Iteration: iter}
+		var paths [][]string
+		var emitted []string
+
+		for i, str := range seqs {
+			path, logPr, err := viterbiPath(1, hmm.emi.Encode(str), hmm.tr, hmm.emi)
+			if err != nil {
+				step.Skipped++
+				continue
+			}
+			step.LogLikelihood += logPr
+			if path != prevPaths[i] {
+				step.Changed++
+				prevPaths[i] = path
+			}
+			paths = append(paths, strings.Fields(path))
+			emitted = append(emitted, str)
+		}
+		if step.Skipped == len(seqs) {
+			return steps, errors.New("the model can not emit any of the training sequences")
+		}
+		steps = append(steps, step)
+		if step.Changed == 0 {
+			break
+		}
+
+		multiAlign, md := pathsToAlignment(paths, emitted, hmm.Length)
+		_, trmap, emimap, err := ProfileMapsWithColumns(md, pseudoCount, hmm.Alphabet, multiAlign)
+		if err != nil {
+			return steps, err
+		}
+		hmm.Trmap, hmm.Emimap = trmap, emimap
+		hmm.Calibration, hmm.HMMERStats = nil, nil //fitted to the scores of the old maps
+		hmm.Compile()
+	}
+	return steps, nil
+}
+
+//pathsToAlignment writes the sequences aligned along their paths (from Start to
+//End) as a multiple alignment that ProfileMapsWithColumns can count. Match
+//column k holds the symbol emitted by Mk, or a dash for Dk. After it comes an
+//insertion block as wide as the longest run of Ik in any path, where each
+//sequence puts its inserted symbols first and fills the rest with dashes.
+//md marks the match columns with 1 and the insertion columns with 0.
+func pathsToAlignment(paths [][]string, seqs []string, length int) ([]string, []int) {
+	//insertions[t][k] are the symbols path t inserts after match state k (k = 0 before M1).
+	insertions := make([][]string, len(paths))
+	matches := make([][]string, len(paths))
+	widest := make([]int, length+1)
+
+	for t, path := range paths {
+		insertions[t] = make([]string, length+1)
+		matches[t] = make([]string, length+1)
+		s := 0
+		for _, state := range path {
+			if state == "Start" || state == "End" {
+				continue
+			}
+			var k int
+			fmt.Sscanf(state[1:], "%d", &k)
+			switch state[0:1] {
+			case "M":
+				matches[t][k] = seqs[t][s : s+1]
+				s++
+			case "D":
+				matches[t][k] = "-"
+			case "I":
+				insertions[t][k] += seqs[t][s : s+1]
+				s++
+			}
+		}
+		for k := range widest {
+			if len(insertions[t][k]) > widest[k] {
+				widest[k] = len(insertions[t][k])
+			}
+		}
+	}
+
+	var md []int
+	for k := 0; k <= length; k++ {
+		if k > 0 {
+			md = append(md, 1)
+		}
+		for w := 0; w < widest[k]; w++ {
+			md = append(md, 0)
+		}
+	}
+
+	multiAlign := make([]string, len(paths))
+	for t := range paths {
+		var row strings.Builder
+		for k := 0; k <= length; k++ {
+			if k > 0 {
+				row.WriteString(matches[t][k])
+			}
+			row.WriteString(insertions[t][k])
+			row.WriteString(strings.Repeat("-", widest[k]-len(insertions[t][k])))
+		}
+		multiAlign[t] = row.String()
+	}
+	return multiAlign, md
+}
+
+//expectedCounts adds the expected number of uses of each transition and emission
+//for one sequence to the count matrices. A transition v1 -> v2 is used at column
+//s with probability forward(v1, s) * tr(v1, v2) * [emission of v2] * backward(v2, s'),
+//divided by Pr(x), where s' is s for hidden states and s+1 for emitting states.
+func (hmm *ProfileHMM) expectedCounts(seq []int, forwardMtx, backwardMtx [][]float64, logPr float64, trCount, emiCount *DenseMtx) {
+	var logUse float64
+	states := hmm.States
+
+	for v1 := range states {
+		for i, v2 := range hmm.tr.To[v1] {
+			hidden := isHiddenState(states[v2])
+			for s := 0; s <= len(seq); s++ {
+				if math.IsInf(forwardMtx[v1][s], -1) {
+					continue
+				}
+				if hidden {
+					logUse = forwardMtx[v1][s] + hmm.tr.ToLogProb[v1][i] + backwardMtx[v2][s]
+				} else if s < len(seq) {
+					logUse = forwardMtx[v1][s] + hmm.tr.ToLogProb[v1][i] + math.Log(hmm.emi.At(v2, seq[s])) + backwardMtx[v2][s+1]
+				} else {
+					continue
+				}
+				trCount.Set(v1, v2, trCount.At(v1, v2)+math.Exp(logUse-logPr))
+			}
+		}
+	}
+
+	for v := range states {
+		if isHiddenState(states[v]) {
+			continue
+		}
+		for s, letter := range seq {
+			if letter < 0 {
+				continue
+			}
+			count := math.Exp(forwardMtx[v][s+1] + backwardMtx[v][s+1] - logPr)
+			cols, shares := hmm.emi.Shares(v, letter) //a degenerate letter counts for the letters it may be
+			for i, c := range cols {
+				emiCount.Set(v, c, emiCount.At(v, c)+count*shares[i])
+			}
+		}
+	}
+}
+
+//reestimate turns the expected counts into the new transition and emission maps
+//of the model. The pseudoCount is added to every transition of the profile
+//topology and every emission of match and insertion states, like TrmapPseudoCount
+//and EmimapPseudoCount do. A row without any count keeps its old values.
+func (hmm *ProfileHMM) reestimate(trCount, emiCount *DenseMtx, pseudoCount float64) {
+	for v2, from := range ProfileTopology(hmm.States) {
+		for _, v1 := range from {
+			trCount.Set(v1, v2, trCount.At(v1, v2)+pseudoCount)
+		}
+	}
+	for v, state := range hmm.States {
+		if !isHiddenState(state) {
+			for c := range hmm.Alphabet {
+				emiCount.Set(v, c, emiCount.At(v, c)+pseudoCount)
+			}
+		}
+	}
+
+	newTrmap, newEmimap := trCount.ToMap(), emiCount.ToMap()
+	for _, state := range hmm.States {
+		keepRowIfEmpty(newTrmap, hmm.Trmap, state)
+		keepRowIfEmpty(newEmimap, hmm.Emimap, state)
+	}
+	(&newTrmap).Normalize()
+	(&newEmimap).Normalize()
+
+	hmm.Trmap, hmm.Emimap = newTrmap, newEmimap
+	hmm.Calibration, hmm.HMMERStats = nil, nil //fitted to the scores of the old maps
+	hmm.Compile()
+}
+
+//keepRowIfEmpty copies the row of the old map into the new map if the row of
+//the new map is all 0.
+func keepRowIfEmpty(newMap, oldMap MtxMap, row string) {
+	for _, value := range newMap[row] {
+		if value != 0 {
+			return
+		}
+	}
+	for col, value := range oldMap[row] {
+		newMap[row][col] = value
+	}
+}
+
+//isHiddenState tells if the state of a profile HMM does not emit: Start, End
+//and the deletion states.
+func isHiddenState(state string) bool {
+	return state[0:1] == "S" || state[0:1] == "E" || state[0:1] == "D"
+}
+
+//String writes the training step as one line of report.
+func (step TrainingStep) String() string {
+	report := fmt.Sprintf("iteration %d\tlog likelihood %.4f", step.Iteration, step.LogLikelihood)
+	if step.Changed > 0 {
+		report += fmt.Sprintf("\t%d paths changed", step.Changed)
+	}
+	if step.Skipped > 0 {
+		report += fmt.Sprintf("\t(%d sequences skipped)", step.Skipped)
+	}
+	return report
+}
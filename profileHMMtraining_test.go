@@ -0,0 +1,151 @@
+package profilehmm
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//sampleSequences returns the sequences of a seed alignment of the sample data
+//without their gaps, as unaligned training sequences.
+func sampleSequences(t *testing.T, file string) []string {
+	t.Helper()
+	in, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	aligns, err := ReadAlignmentsPfam(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs := make([]string, len(aligns))
+	for i, align := range aligns {
+		seqs[i] = strings.ToUpper(strings.NewReplacer("-", "", ".", "").Replace(align))
+	}
+	return seqs
+}
+
+//TestFlatProfileHMMIsValid checks that the starting model of training passes
+//the same checks as a model loaded from files.
+func TestFlatProfileHMMIsValid(t *testing.T) {
+	for _, length := range []int{1, 2, 48} {
+		hmm, err := FlatProfileHMM("flat", length, Amino, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := ValidateMaps(hmm.Alphabet, hmm.States, hmm.Trmap, hmm.Emimap); len(problems) > 0 {
+			t.Errorf("length %d: %v", length, problems)
+		}
+	}
+	if _, err := FlatProfileHMM("flat", 0, Amino, 1); err == nil {
+		t.Error("FlatProfileHMM made a model without match states")
+	}
+}
+
+//TestBaumWelchImproves trains a flat model on the SH3 seed sequences, and
+//checks that the log likelihood never goes down from one iteration to the
+//next, as expectation maximization promises. Without a pseudocount the new
+//maps are the maximum likelihood ones; the small slack is for rounding.
+func TestBaumWelchImproves(t *testing.T) {
+	seqs := sampleSequences(t, "sample_data/SH3/Pfam_PF00018_seed.txt")
+	hmm, err := FlatProfileHMM("SH3", 48, Amino, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps, err := hmm.BaumWelch(seqs, 0, 8, 1e-6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) < 2 {
+		t.Fatalf("only %d iterations", len(steps))
+	}
+	for i := 1; i < len(steps); i++ {
+		if steps[i].Skipped != 0 {
+			t.Errorf("iteration %d skipped %d sequences", steps[i].Iteration, steps[i].Skipped)
+		}
+		if steps[i].LogLikelihood < steps[i-1].LogLikelihood-1e-6 {
+			t.Errorf("log likelihood went down from %.6f to %.6f at iteration %d",
+				steps[i-1].LogLikelihood, steps[i].LogLikelihood, steps[i].Iteration)
+		}
+	}
+	if problems := ValidateMaps(hmm.Alphabet, hmm.States, hmm.Trmap, hmm.Emimap); len(problems) > 0 {
+		t.Errorf("trained model is not valid: %v", problems)
+	}
+}
+
+//TestPathsToAlignment checks the alignment written from hand made paths: match
+//and delete columns, insertions before M1 and after the last match state, and
+//insertion blocks as wide as the longest insertion.
+func TestPathsToAlignment(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		paths  []string
+		seqs   []string
+		want   []string
+		wantMD []int
+	}{
+		{"matches and deletions", 3,
+			[]string{"Start M1 D2 M3 End", "Start M1 M2 M3 End", "Start D1 D2 M3 End"},
+			[]string{"AC", "ADE", "W"},
+			[]string{"A-C", "ADE", "--W"},
+			[]int{1, 1, 1}},
+		{"insertions before M1", 2,
+			[]string{"Start I0 I0 M1 M2 End", "Start M1 D2 End"},
+			[]string{"GGAC", "A"},
+			[]string{"GGAC", "--A-"},
+			[]int{0, 0, 1, 1}},
+		{"insertions of uneven widths", 2,
+			[]string{"Start M1 I1 I1 I1 M2 End", "Start M1 I1 M2 End", "Start D1 M2 End"},
+			[]string{"AKLMC", "AKC", "C"},
+			[]string{"AKLMC", "AK--C", "----C"},
+			[]int{1, 0, 0, 0, 1}},
+		{"insertions after the last match state", 2,
+			[]string{"Start M1 D2 I2 End", "Start M1 M2 End", "Start D1 I1 M2 I2 I2 End"},
+			[]string{"AK", "AC", "QCRS"},
+			[]string{"A--K-", "A-C--", "-QCRS"},
+			[]int{1, 0, 1, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths := make([][]string, len(test.paths))
+			for i, path := range test.paths {
+				paths[i] = strings.Fields(path)
+			}
+			got, md := pathsToAlignment(paths, test.seqs, test.length)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("alignment is %q, want %q", got, test.want)
+			}
+			if !reflect.DeepEqual(md, test.wantMD) {
+				t.Errorf("match columns are %v, want %v", md, test.wantMD)
+			}
+		})
+	}
+}
+
+//TestViterbiTrainingConverges trains the SH3 model on its own seed sequences
+//and checks that training stops at the first iteration where no path changes,
+//before running out of iterations.
+func TestViterbiTrainingConverges(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	seqs := sampleSequences(t, "sample_data/SH3/Pfam_PF00018_seed.txt")
+	const maxIter = 20
+	steps, err := hmm.ViterbiTraining(seqs, DefaultPseudoCount, maxIter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := steps[len(steps)-1]
+	if last.Changed != 0 || len(steps) == maxIter {
+		t.Fatalf("training did not converge in %d iterations: %v", len(steps), last)
+	}
+	for _, step := range steps[:len(steps)-1] {
+		if step.Changed == 0 {
+			t.Errorf("training went on after iteration %d where no path changed", step.Iteration)
+		}
+	}
+	if steps[0].Changed != len(seqs)-steps[0].Skipped {
+		t.Errorf("first iteration changed %d paths, want every one of %d", steps[0].Changed, len(seqs)-steps[0].Skipped)
+	}
+}
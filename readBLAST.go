@@ -0,0 +1,472 @@
+//This file reads the alignments BLAST gives for a protein query. Three kinds of
+//output are understood:
+//1. The query-anchored text alignment (-outfmt 2 to 4, or "Multiple alignment"
+//   on the web), which BLAST wraps into blocks of 60 columns. Each block starts
+//   with the query line, and the subjects are joined across blocks.
+//2. BLAST XML (-outfmt 5).
+//3. Tabular output (-outfmt 6 or 7) that includes the aligned sequences qseq and sseq.
+//A file may hold the alignments of many queries; they are returned one by one.
+//The pairwise alignments of XML and tabular output are put together into one
+//alignment anchored on the query, in the same way as the text output.
+
+package profilehmm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//BlastRow is one row of a BLAST alignment: the name of the sequence, the first
+//and last residue of the row in that sequence (0 if BLAST did not give them),
+//and the aligned string with "-" for gaps.
+type BlastRow struct {
+	Name       string
+	Start, End int
+	Row        string
+}
+
+//BlastAlignment is the alignment of one query. Rows[0] is the query itself and
+//the other rows are the subjects in the order BLAST reported them. A subject
+//with several HSPs has one row for each.
+type BlastAlignment struct {
+	Query string
+	Rows  []BlastRow
+}
+
+//Strings returns the aligned strings of the rows, the query first, like ReadAlignmentsBLAST.
+func (blast *BlastAlignment) Strings() []string {
+	strs := make([]string, len(blast.Rows))
+	for i := range blast.Rows {
+		strs[i] = blast.Rows[i].Row
+	}
+	return strs
+}
+
+//ReadBLAST reads a BLAST output file, telling XML, tabular and text output apart
+//by the first line, and returns the alignment of each query.
+func ReadBLAST(file io.Reader) ([]*BlastAlignment, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	var blasts []*BlastAlignment
+	switch firstLine := firstNonBlankLine(data); {
+	case strings.HasPrefix(firstLine, "<?xml") || strings.HasPrefix(firstLine, "<BlastOutput"):
+		blasts, err = readBLASTXML(data)
+	case strings.HasPrefix(firstLine, "# ") || strings.Contains(firstLine, "\t"):
+		blasts, err = readBLASTTabular(data)
+	default:
+		blasts, err = readBLASTText(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(blasts) == 0 {
+		return nil, errors.New("blast: no alignment found")
+	}
+	return blasts, nil
+}
+
+//readBLASTText reads query-anchored text output. A line "Query= ...", "Query: ..."
+//or "Query #n: ..." starts a new query. A block starts at a query line (a name
+//starting with "Query", the start position, the aligned string and the end
+//position) and goes on until a blank line. The column of the aligned string in
+//the query line is where the aligned strings of the rows below it are cut from.
+//Rows are matched across blocks by name, and by order for a name given twice.
+//A row missing from a block gets gaps there. A "." is taken as the query residue
+//of that column, as BLAST writes identities when asked to.
+func readBLASTText(data []byte) ([]*BlastAlignment, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var blasts []*BlastAlignment
+	var blast *BlastAlignment
+	var rows []*strings.Builder
+	var rowIdx map[string]int //name and its number within a block, to the index of the row
+	var total int             //columns of the blocks before this one
+
+	//block state
+	inBlock := false
+	var startIdx, width int
+	var queryName, queryStr string
+	var seen []bool
+	var count map[string]int
+
+	endBlock := func() {
+		if !inBlock {
+			return
+		}
+		for i := range rows {
+			if !seen[i] {
+				rows[i].WriteString(strings.Repeat("-", width))
+			}
+		}
+		total += width
+		inBlock = false
+	}
+	endQuery := func() {
+		endBlock()
+		if blast != nil && len(rows) > 0 {
+			for i := range rows {
+				blast.Rows[i].Row = rows[i].String()
+			}
+			blasts = append(blasts, blast)
+		}
+		blast = nil
+	}
+	newQuery := func(name string) {
+		endQuery()
+		blast = &BlastAlignment{Query: name}
+		rows = nil
+		rowIdx = make(map[string]int)
+		total = 0
+	}
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			endBlock()
+			continue
+		}
+		if strings.HasPrefix(trimmed, "Query=") || strings.HasPrefix(trimmed, "Query:") || strings.HasPrefix(trimmed, "Query #") {
+			name := strings.TrimSpace(trimmed[strings.IndexAny(trimmed, "=:")+1:])
+			if idx := strings.Index(name, "Query ID:"); idx >= 0 { //web output: "Query: <title> Query ID: <id> Length: <n>"
+				name = restOfLine(name[idx:], 2)
+			}
+			if fields := strings.Fields(name); len(fields) > 0 {
+				name = fields[0]
+			}
+			newQuery(name)
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if isBLASTQueryLine(fields) && (!inBlock || fields[0] == queryName) {
+			endBlock()
+			if blast == nil {
+				newQuery("")
+			}
+			inBlock = true
+			queryName, queryStr = fields[0], fields[2]
+			startIdx = blastColumn(line, fields)
+			width = len(queryStr)
+			seen = make([]bool, len(rows))
+			count = make(map[string]int)
+			if blast.Query == "" {
+				blast.Query = queryName
+			}
+		} else if !inBlock {
+			continue //headers, the list of hits and other text
+		}
+
+		//a row of the block, the query row included
+		var prefix []string
+		if len(line) > startIdx {
+			prefix = strings.Fields(line[:startIdx])
+		} else {
+			prefix = strings.Fields(line)
+		}
+		if len(prefix) == 0 || len(prefix) > 2 {
+			return nil, fmt.Errorf("blast line %d: expected name and start position before column %d", lineNum, startIdx+1)
+		}
+		key := prefix[0] + "\x00" + strconv.Itoa(count[prefix[0]])
+		count[prefix[0]]++
+		i, ok := rowIdx[key]
+		if !ok {
+			i = len(rows)
+			rowIdx[key] = i
+			rows = append(rows, &strings.Builder{})
+			rows[i].WriteString(strings.Repeat("-", total))
+			seen = append(seen, false)
+			name := prefix[0]
+			if i == 0 && blast.Query != "" {
+				name = blast.Query
+			}
+			blast.Rows = append(blast.Rows, BlastRow{Name: name})
+		}
+		if seen[i] {
+			return nil, fmt.Errorf("blast line %d: row %s given twice in the block", lineNum, prefix[0])
+		}
+		seen[i] = true
+
+		var part string
+		if len(line) > startIdx {
+			part = line[startIdx:min(len(line), startIdx+width)]
+		}
+		aligned := []byte(part + strings.Repeat(" ", width-len(part)))
+		for c := range aligned {
+			switch aligned[c] {
+			case ' ':
+				aligned[c] = '-'
+			case '.':
+				aligned[c] = queryStr[c]
+			default:
+				aligned[c] = strings.ToUpper(string(aligned[c]))[0]
+			}
+		}
+		rows[i].Write(aligned)
+
+		if len(prefix) == 2 {
+			if n, err := strconv.Atoi(prefix[1]); err == nil && blast.Rows[i].Start == 0 {
+				blast.Rows[i].Start = n
+			}
+		}
+		if len(line) > startIdx+width {
+			if suffix := strings.Fields(line[startIdx+width:]); len(suffix) > 0 {
+				if n, err := strconv.Atoi(suffix[0]); err == nil {
+					blast.Rows[i].End = n
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	endQuery()
+	return blasts, nil
+}
+
+//isBLASTQueryLine tells if the fields are those of the query line of a block:
+//"Query..." followed by the start position, the aligned string and the end position.
+func isBLASTQueryLine(fields []string) bool {
+	if len(fields) != 4 || !strings.HasPrefix(fields[0], "Query") {
+		return false
+	}
+	_, err1 := strconv.Atoi(fields[1])
+	_, err3 := strconv.Atoi(fields[3])
+	return err1 == nil && err3 == nil
+}
+
+//blastColumn returns the column of the aligned string (fields[2]) in the query line.
+func blastColumn(line string, fields []string) int {
+	idx := 0
+	for f := 0; f < 2; f++ {
+		idx += strings.Index(line[idx:], fields[f]) + len(fields[f])
+	}
+	return idx + strings.Index(line[idx:], fields[2])
+}
+
+//blastHSP is one pairwise alignment of the query and a subject, as read from
+//XML or tabular output.
+type blastHSP struct {
+	subject            string
+	qFrom, qTo         int
+	sFrom, sTo         int
+	qAligned, sAligned string
+}
+
+//queryAnchored puts the pairwise alignments of a query together into one
+//alignment. There is a column for each query residue from the first to the last
+//one covered by an HSP; residues of the subject aligned to gaps of the query
+//are insertions after the query residue before them, and the columns of each
+//insertion are as wide as the longest one among the HSPs. Query residues that no
+//HSP covers are written as "X".
+func queryAnchored(query string, hsps []blastHSP) (*BlastAlignment, error) {
+	lo, hi := 0, 0
+	for h, hsp := range hsps {
+		if hsp.qFrom < 1 || hsp.qTo < hsp.qFrom || len(hsp.qAligned) != len(hsp.sAligned) {
+			return nil, fmt.Errorf("blast: bad HSP of %s against %s", query, hsp.subject)
+		}
+		if h == 0 || hsp.qFrom < lo {
+			lo = hsp.qFrom
+		}
+		if hsp.qTo > hi {
+			hi = hsp.qTo
+		}
+	}
+
+	//residues of each subject at each query position, and the insertion after it.
+	queryRes := []byte(strings.Repeat("X", hi-lo+1))
+	widest := make([]int, hi-lo+1)
+	match := make([][]byte, len(hsps))
+	insert := make([][]string, len(hsps))
+	for h, hsp := range hsps {
+		match[h] = []byte(strings.Repeat("-", hi-lo+1))
+		insert[h] = make([]string, hi-lo+1)
+		p := hsp.qFrom - lo - 1
+		for c := 0; c < len(hsp.qAligned); c++ {
+			if hsp.qAligned[c] == '-' {
+				if p < 0 {
+					return nil, fmt.Errorf("blast: HSP of %s against %s starts with a gap in the query", query, hsp.subject)
+				}
+				insert[h][p] += string(hsp.sAligned[c])
+				if len(insert[h][p]) > widest[p] {
+					widest[p] = len(insert[h][p])
+				}
+				continue
+			}
+			p++
+			if p > hi-lo {
+				return nil, fmt.Errorf("blast: HSP of %s against %s is longer than its query range", query, hsp.subject)
+			}
+			queryRes[p] = strings.ToUpper(string(hsp.qAligned[c]))[0]
+			match[h][p] = strings.ToUpper(string(hsp.sAligned[c]))[0]
+		}
+	}
+
+	blast := &BlastAlignment{Query: query}
+	var row strings.Builder
+	for p := range queryRes {
+		row.WriteByte(queryRes[p])
+		row.WriteString(strings.Repeat("-", widest[p]))
+	}
+	blast.Rows = append(blast.Rows, BlastRow{Name: query, Start: lo, End: hi, Row: row.String()})
+	for h, hsp := range hsps {
+		row.Reset()
+		for p := range queryRes {
+			row.WriteByte(match[h][p])
+			row.WriteString(strings.ToUpper(insert[h][p]))
+			row.WriteString(strings.Repeat("-", widest[p]-len(insert[h][p])))
+		}
+		blast.Rows = append(blast.Rows, BlastRow{Name: hsp.subject, Start: hsp.sFrom, End: hsp.sTo, Row: row.String()})
+	}
+	return blast, nil
+}
+
+//blastXMLOutput holds the parts of BLAST XML (-outfmt 5) that are needed.
+type blastXMLOutput struct {
+	Iterations []struct {
+		QueryID  string `xml:"Iteration_query-ID"`
+		QueryDef string `xml:"Iteration_query-def"`
+		Hits     []struct {
+			ID        string `xml:"Hit_id"`
+			Accession string `xml:"Hit_accession"`
+			HSPs      []struct {
+				QueryFrom int    `xml:"Hsp_query-from"`
+				QueryTo   int    `xml:"Hsp_query-to"`
+				HitFrom   int    `xml:"Hsp_hit-from"`
+				HitTo     int    `xml:"Hsp_hit-to"`
+				QSeq      string `xml:"Hsp_qseq"`
+				HSeq      string `xml:"Hsp_hseq"`
+			} `xml:"Hit_hsps>Hsp"`
+		} `xml:"Iteration_hits>Hit"`
+	} `xml:"BlastOutput_iterations>Iteration"`
+}
+
+//readBLASTXML reads BLAST XML, one alignment for each iteration (query) with hits.
+func readBLASTXML(data []byte) ([]*BlastAlignment, error) {
+	var output blastXMLOutput
+	if err := xml.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("blast xml: %v", err)
+	}
+	var blasts []*BlastAlignment
+	for _, iteration := range output.Iterations {
+		query := iteration.QueryID
+		if fields := strings.Fields(iteration.QueryDef); len(fields) > 0 {
+			query = fields[0]
+		}
+		var hsps []blastHSP
+		for _, hit := range iteration.Hits {
+			name := hit.Accession
+			if name == "" {
+				name = hit.ID
+			}
+			for _, hsp := range hit.HSPs {
+				hsps = append(hsps, blastHSP{name, hsp.QueryFrom, hsp.QueryTo, hsp.HitFrom, hsp.HitTo, hsp.QSeq, hsp.HSeq})
+			}
+		}
+		if len(hsps) == 0 {
+			continue
+		}
+		blast, err := queryAnchored(query, hsps)
+		if err != nil {
+			return nil, err
+		}
+		blasts = append(blasts, blast)
+	}
+	return blasts, nil
+}
+
+//blastTabularFields names the columns of tabular output as written on the
+//"# Fields:" line of -outfmt 7, for the columns that are needed.
+var blastTabularFields = map[string]string{
+	"query id": "qseqid", "query acc.": "qseqid", "query acc.ver": "qseqid", "query seqid": "qseqid",
+	"subject id": "sseqid", "subject acc.": "sseqid", "subject acc.ver": "sseqid", "subject seqid": "sseqid",
+	"q. start": "qstart", "q. end": "qend", "s. start": "sstart", "s. end": "send",
+	"query seq": "qseq", "subject seq": "sseq",
+}
+
+//readBLASTTabular reads tabular output. The columns are taken from the "# Fields:"
+//line when there is one (-outfmt 7); otherwise they are assumed to be
+//-outfmt "6 std qseq sseq", the twelve standard columns and the aligned sequences.
+//The HSPs are grouped by query in the order the queries first appear.
+func readBLASTTabular(data []byte) ([]*BlastAlignment, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	column := map[string]int{"qseqid": 0, "sseqid": 1, "qstart": 6, "qend": 7, "sstart": 8, "send": 9, "qseq": 12, "sseq": 13}
+	var queries []string
+	hsps := make(map[string][]blastHSP)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "# Fields:") {
+			column = make(map[string]int)
+			for c, field := range strings.Split(strings.TrimSpace(strings.TrimPrefix(line, "# Fields:")), ",") {
+				if name, ok := blastTabularFields[strings.TrimSpace(field)]; ok {
+					column[name] = c
+				}
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		values := make(map[string]string)
+		for _, name := range []string{"qseqid", "sseqid", "qstart", "qend", "sstart", "send", "qseq", "sseq"} {
+			c, ok := column[name]
+			if !ok || c >= len(fields) {
+				return nil, fmt.Errorf("blast tabular line %d: no %s column (the output needs qseq and sseq)", lineNum, name)
+			}
+			values[name] = strings.TrimSpace(fields[c])
+		}
+		var pos [4]int
+		for p, name := range []string{"qstart", "qend", "sstart", "send"} {
+			n, err := strconv.Atoi(values[name])
+			if err != nil {
+				return nil, fmt.Errorf("blast tabular line %d: %s is not a number: %q", lineNum, name, values[name])
+			}
+			pos[p] = n
+		}
+		query := values["qseqid"]
+		if _, ok := hsps[query]; !ok {
+			queries = append(queries, query)
+		}
+		hsps[query] = append(hsps[query], blastHSP{values["sseqid"], pos[0], pos[1], pos[2], pos[3], values["qseq"], values["sseq"]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var blasts []*BlastAlignment
+	for _, query := range queries {
+		blast, err := queryAnchored(query, hsps[query])
+		if err != nil {
+			return nil, err
+		}
+		blasts = append(blasts, blast)
+	}
+	return blasts, nil
+}
+
+//firstNonBlankLine returns the first line of the data that is not blank, trimmed.
+func firstNonBlankLine(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
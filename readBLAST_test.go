@@ -0,0 +1,175 @@
+package profilehmm
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//wrappedBLAST is query-anchored text output of two queries. The alignment of
+//the first one is wrapped into two blocks; s2 is missing from the second block
+//and writes identities as ".".
+const wrappedBLAST = `BLASTP 2.12.0+
+
+Query= q1 some protein
+
+Query_1  1   ACDEFGHIKL  10
+s1       5   ACDE-GHIKL  13
+s2       1   ..........  10
+
+Query_1  11  MNPQ  14
+s1       14  MN.q  17
+
+Query= q2
+
+Query_2  1  ACD  3
+s3       7  A-D  8
+`
+
+//xmlBLAST is BLAST XML of one query with two hits; the HSP of s1 has an
+//insertion after the E of the query, and s2 has no accession.
+const xmlBLAST = `<?xml version="1.0"?>
+<BlastOutput>
+<BlastOutput_iterations>
+<Iteration>
+  <Iteration_query-ID>Query_1</Iteration_query-ID>
+  <Iteration_query-def>q1 some protein</Iteration_query-def>
+  <Iteration_hits>
+    <Hit>
+      <Hit_id>gnl|BL_ORD_ID|1</Hit_id>
+      <Hit_accession>s1</Hit_accession>
+      <Hit_hsps><Hsp>
+        <Hsp_query-from>2</Hsp_query-from><Hsp_query-to>6</Hsp_query-to>
+        <Hsp_hit-from>10</Hsp_hit-from><Hsp_hit-to>15</Hsp_hit-to>
+        <Hsp_qseq>CDE-FG</Hsp_qseq><Hsp_hseq>CDEKFG</Hsp_hseq>
+      </Hsp></Hit_hsps>
+    </Hit>
+    <Hit>
+      <Hit_id>s2</Hit_id>
+      <Hit_accession></Hit_accession>
+      <Hit_hsps><Hsp>
+        <Hsp_query-from>1</Hsp_query-from><Hsp_query-to>4</Hsp_query-to>
+        <Hsp_hit-from>3</Hsp_hit-from><Hsp_hit-to>5</Hsp_hit-to>
+        <Hsp_qseq>ACDE</Hsp_qseq><Hsp_hseq>AC-E</Hsp_hseq>
+      </Hsp></Hit_hsps>
+    </Hit>
+  </Iteration_hits>
+</Iteration>
+</BlastOutput_iterations>
+</BlastOutput>
+`
+
+//TestReadBLAST reads each kind of BLAST output and checks the rows, names and
+//coordinates of every query.
+func TestReadBLAST(t *testing.T) {
+	tests := []struct {
+		name, file string
+		want       []*BlastAlignment
+	}{
+		{"wrapped text of two queries", wrappedBLAST, []*BlastAlignment{
+			{Query: "q1", Rows: []BlastRow{
+				{"q1", 1, 14, "ACDEFGHIKLMNPQ"},
+				{"s1", 5, 17, "ACDE-GHIKLMNPQ"},
+				{"s2", 1, 10, "ACDEFGHIKL----"},
+			}},
+			{Query: "q2", Rows: []BlastRow{
+				{"q2", 1, 3, "ACD"},
+				{"s3", 7, 8, "A-D"},
+			}},
+		}},
+		{"xml", xmlBLAST, []*BlastAlignment{
+			{Query: "q1", Rows: []BlastRow{
+				{"q1", 1, 6, "ACDE-FG"},
+				{"s1", 10, 15, "-CDEKFG"},
+				{"s2", 3, 5, "AC-E---"},
+			}},
+		}},
+		{"tabular of two queries", "q1\ts1\t100\t4\t0\t0\t1\t4\t5\t8\t1e-5\t30\tACDE\tACDE\n" +
+			"q1\ts2\t75\t3\t1\t0\t2\t4\t1\t3\t1e-3\t20\tCDE\tCKE\n" +
+			"q2\ts3\t100\t3\t0\t0\t3\t5\t1\t3\t1\t10\tKLM\tKLM\n", []*BlastAlignment{
+			{Query: "q1", Rows: []BlastRow{
+				{"q1", 1, 4, "ACDE"},
+				{"s1", 5, 8, "ACDE"},
+				{"s2", 1, 3, "-CKE"},
+			}},
+			{Query: "q2", Rows: []BlastRow{
+				{"q2", 3, 5, "KLM"},
+				{"s3", 1, 3, "KLM"},
+			}},
+		}},
+		{"tabular with a fields line", "# BLASTP 2.12.0+\n# Query: q1\n" +
+			"# Fields: subject id, query acc.ver, query seq, subject seq, q. start, q. end, s. start, s. end\n" +
+			"s1\tq1\tAC-DE\tACKDE\t1\t4\t2\t6\n", []*BlastAlignment{
+			{Query: "q1", Rows: []BlastRow{
+				{"q1", 1, 4, "AC-DE"},
+				{"s1", 2, 6, "ACKDE"},
+			}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blasts, err := ReadBLAST(strings.NewReader(test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blasts) != len(test.want) {
+				t.Fatalf("got %d queries, want %d", len(blasts), len(test.want))
+			}
+			for q := range blasts {
+				if !reflect.DeepEqual(blasts[q], test.want[q]) {
+					t.Errorf("query %d is %+v, want %+v", q+1, blasts[q], test.want[q])
+				}
+			}
+		})
+	}
+}
+
+//TestReadBLASTErrors checks the outputs that ReadBLAST refuses.
+func TestReadBLASTErrors(t *testing.T) {
+	tests := []struct {
+		name, file, wantErr string
+	}{
+		{"no alignment", "BLASTP 2.12.0+\n\nQuery= q1\n\n***** No hits found *****\n", "no alignment found"},
+		{"tabular without the aligned sequences", "q1\ts1\t100\t4\t0\t0\t1\t4\t5\t8\t1e-5\t30\n", "no qseq column"},
+		{"tabular position that is not a number", "q1\ts1\t100\t4\t0\t0\tone\t4\t5\t8\t1e-5\t30\tACDE\tACDE\n", "qstart is not a number"},
+		{"tabular HSP that ends before it starts", "q1\ts1\t100\t4\t0\t0\t4\t1\t5\t8\t1e-5\t30\tACDE\tACDE\n", "bad HSP of q1 against s1"},
+		{"broken xml", "<?xml version=\"1.0\"?>\n<BlastOutput><BlastOutput_iterations>\n", "blast xml"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadBLAST(strings.NewReader(test.file))
+			if err == nil {
+				t.Fatal("ReadBLAST accepted the output")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error is %q, want it to mention %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+//TestReadBLASTSamples reads the BLAST files of the sample data, and checks that
+//their rows are joined into an alignment with the query first.
+func TestReadBLASTSamples(t *testing.T) {
+	for _, file := range []string{
+		"sample_data/SH3/Blast_X2BDNTDM013-Alignment.txt",
+		"sample_data/SH3/Blast_blastp_query_anchored.txt",
+	} {
+		in, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := ReadAlignmentsBLAST(in)
+		in.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if len(rows) < 2 {
+			t.Fatalf("%s: got %d rows, want the query and its subjects", file, len(rows))
+		}
+		if err := checkAlignments(rows); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
@@ -1,7 +1,8 @@
-package main
+package profilehmm
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,139 +11,244 @@ import (
 )
 
 //Takes the file downloaded from Pfam and collect all the alignments as same
-//length strings. Add all the strings into a slice of strings.
-func ReadAlignmentsPfam(file io.Reader) []string {
+//length strings. Add all the strings into a slice of strings. Each line has the
+//ID and the aligned string separated by spaces; blank lines are skipped.
+func ReadAlignmentsPfam(file io.Reader) ([]string, error) {
 	var alignments []string
-	br := bufio.NewReader(file)
-	for {
-		var ID, strg string
-		if _, err := fmt.Fscanln(br, &ID, &strg); err != nil {
-			break
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
 		}
-		alignments = append(alignments, strg)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("pfam alignment line %d: expected ID and aligned string, got %d fields", lineNum, len(fields))
+		}
+		alignments = append(alignments, fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
 	}
-	return alignments
+	return alignments, nil
 }
 
-//Takes the file downloaded from BLAST. First find the length of the query string
-//with "-" dashes. Then find the position of the string in the line. Collect all
-//the aligned string at the exact positoin, replace the front and end spaces with
-//"-" dashes. Finally, add all the aligned strings into a slice of strings.
-func ReadAlignmentsBLAST(file io.Reader) []string {
-	var alignments []string
-	scanner := bufio.NewScanner(file)
-
-	var eachline, q, str string
-	var n, length, startIdx int
-	for i := 0; i < 6; i++ {
-		if scanner.Scan() && i == 5 {
-			eachline = scanner.Text()
-			fmt.Sscanln(eachline, &q, &n, &str)
-			startIdx = strings.Index(eachline, str)
-			length = len(str)
-			alignments = append(alignments, str)
-		}
+//Takes the file downloaded from BLAST and returns the aligned strings of its
+//first query, the query first. See ReadBLAST for the kinds of output it reads;
+//the wrapped blocks of the text output are joined into whole rows.
+func ReadAlignmentsBLAST(file io.Reader) ([]string, error) {
+	blasts, err := ReadBLAST(file)
+	if err != nil {
+		return nil, err
 	}
+	return blasts[0].Strings(), nil
+}
+
+//ReadFasta takes a FASTA file of (unaligned) sequences and returns the name and
+//the sequence of each record. The name is the first word after ">", and a
+//sequence may go over many lines. Letters are turned to upper case, and spaces
+//and the "*" that marks the stop codon are removed.
+func ReadFasta(file io.Reader) (names, seqs []string, err error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var seq strings.Builder
+	inRecord := false
+	lineNum := 0
 
 	for scanner.Scan() {
-		eachline = scanner.Text()
-		if len(eachline) != 0 {
-			alignedStr := eachline[startIdx : startIdx+length]
-			alignedStr = strings.ReplaceAll(alignedStr, " ", "-")
-			alignments = append(alignments, alignedStr)
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, ">") {
+			if inRecord {
+				seqs = append(seqs, seq.String())
+			}
+			fields := strings.Fields(line[1:])
+			if len(fields) == 0 {
+				return nil, nil, fmt.Errorf("fasta line %d: record without a name", lineNum)
+			}
+			names = append(names, fields[0])
+			seq.Reset()
+			inRecord = true
+		} else if line != "" && !strings.HasPrefix(line, ";") {
+			if !inRecord {
+				return nil, nil, fmt.Errorf("fasta line %d: sequence before the first \">\" line", lineNum)
+			}
+			line = strings.ReplaceAll(strings.Join(strings.Fields(line), ""), "*", "")
+			seq.WriteString(strings.ToUpper(line))
 		}
 	}
-	return alignments
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if inRecord {
+		seqs = append(seqs, seq.String())
+	}
+	return names, seqs, nil
 }
 
 //Turn the map of map into txt file. The file is formated to have a matrix looking,
 //neat style. Each entry has a width of 9 to accommodate 4 decimal spaces.
-func MapToFile(outFileName string, rowheader, colheader []string, theMap MtxMap) {
-	outFile, err3 := os.Create(outFileName)
-
-	if err3 != nil {
-		fmt.Println("Error in creating the file.")
+//Rounding loses the small probabilities, so this is a view for people to read;
+//use MapToFileExact for files that models are loaded from.
+func MapToFile(outFileName string, rowheader, colheader []string, theMap MtxMap) error {
+	outFile, err := os.Create(outFileName)
+	if err != nil {
+		return err
 	}
-	defer outFile.Close()
 
-	fmt.Fprintf(outFile, "%-9s", " ")
+	WriteMap(outFile, rowheader, colheader, theMap)
+	return outFile.Close()
+}
+
+//WriteMap writes the map of map to the writer in the same matrix looking style as MapToFile.
+func WriteMap(w io.Writer, rowheader, colheader []string, theMap MtxMap) {
+	fmt.Fprintf(w, "%-9s", " ")
 	for _, h := range colheader {
-		fmt.Fprintf(outFile, "%-9s", h)
+		fmt.Fprintf(w, "%-9s", h)
 	}
-	fmt.Fprintln(outFile, " ")
+	fmt.Fprintln(w, " ")
 
 	_, _, outMap := MapToMtx(rowheader, colheader, theMap)
 
 	for i := range outMap {
-		fmt.Fprintf(outFile, "%-9s", rowheader[i])
+		fmt.Fprintf(w, "%-9s", rowheader[i])
+		for j := range outMap[i] {
+			fmt.Fprintf(w, "%-9.4f", RoundTo(outMap[i][j], 4))
+		}
+		fmt.Fprintln(w, " ")
+	}
+}
+
+//MapToFileExact writes the map of map into a txt file like MapToFile, but with
+//every entry in full float64 precision, so that FileToMap reads back exactly the
+//same numbers.
+func MapToFileExact(outFileName string, rowheader, colheader []string, theMap MtxMap) error {
+	outFile, err := os.Create(outFileName)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteMapExact(outFile, rowheader, colheader, theMap); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
+
+//WriteMapExact writes the map of map to the writer in the matrix looking style
+//of WriteMap, with each entry in the shortest form that parses back to the same
+//float64. The columns are as wide as the longest entry, and at least 9.
+func WriteMapExact(w io.Writer, rowheader, colheader []string, theMap MtxMap) error {
+	_, _, outMap := MapToMtx(rowheader, colheader, theMap)
+	entries := make([][]string, len(outMap))
+	width := 9
+	for _, h := range append(append([]string{}, rowheader...), colheader...) {
+		if len(h)+1 > width {
+			width = len(h) + 1
+		}
+	}
+	for i := range outMap {
+		entries[i] = make([]string, len(outMap[i]))
 		for j := range outMap[i] {
-			fmt.Fprintf(outFile, "%-9.4f", RoundTo(outMap[i][j], 4))
+			entries[i][j] = strconv.FormatFloat(outMap[i][j], 'g', -1, 64)
+			if len(entries[i][j])+1 > width {
+				width = len(entries[i][j]) + 1
+			}
 		}
-		fmt.Fprintln(outFile, " ")
 	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-*s", width, " ")
+	for _, h := range colheader {
+		fmt.Fprintf(bw, "%-*s", width, h)
+	}
+	fmt.Fprintln(bw, " ")
+	for i := range entries {
+		fmt.Fprintf(bw, "%-*s", width, rowheader[i])
+		for j := range entries[i] {
+			fmt.Fprintf(bw, "%-*s", width, entries[i][j])
+		}
+		fmt.Fprintln(bw, " ")
+	}
+	return bw.Flush()
 }
 
 //FileToMap takes a transition or emission file, returns a map that represents
 //the transition or emission matrix(map of map). It also returns a column header.
-func FileToMap(file io.Reader) (MtxMap, []string) {
-	//OutMap := make(MtxMap, len(rowheader))
+//It returns an error, with the line number, for a row that does not have one
+//number for each column, a number that can not be parsed, or a row given twice.
+func FileToMap(file io.Reader) (MtxMap, []string, error) {
 	OutMap := make(MtxMap)
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
 
-	scanner.Scan()
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("map file is empty")
+	}
 	colheader := strings.Fields(scanner.Text())
+	if len(colheader) == 0 {
+		return nil, nil, errors.New("map file line 1: missing column header")
+	}
 
 	var eachline []string
-	var entryStr, rheader string
+	var rheader string
 	var rowEntry map[string]float64
-	
+	lineNum := 1
+
 	for scanner.Scan() {
+		lineNum++
 		eachline = strings.Fields(scanner.Text())
+		if len(eachline) == 0 {
+			continue
+		}
 		rheader = eachline[0]
+		if _, ok := OutMap[rheader]; ok {
+			return nil, nil, fmt.Errorf("map file line %d: row %s is given twice", lineNum, rheader)
+		}
+		if len(eachline)-1 != len(colheader) {
+			return nil, nil, fmt.Errorf("map file line %d: row %s has %d numbers, expected %d", lineNum, rheader, len(eachline)-1, len(colheader))
+		}
 		rowEntry = make(map[string]float64)
 		for c := 1; c < len(eachline); c++ {
-			entryStr = eachline[c]
-			if entry, err := strconv.ParseFloat(entryStr, 64); err == nil {
-				rowEntry[colheader[c-1]] = entry
+			entry, err := strconv.ParseFloat(eachline[c], 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("map file line %d: %s -> %s is not a number: %q", lineNum, rheader, colheader[c-1], eachline[c])
 			}
-			OutMap[rheader] = rowEntry
+			rowEntry[colheader[c-1]] = entry
 		}
+		OutMap[rheader] = rowEntry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
 	}
-	return OutMap, colheader
+	return OutMap, colheader, nil
 }
 
-//This function has assumed user input, as asked from upper level function. It
-//takes in name of the files (transition and emission files), and return the
-//the contents of the file as map or map for transition and emision matrix. It
+//ReadMaps takes in name of the files (transition and emission files), and return
+//the contents of the file as map of map for transition and emision matrix. It
 //also returns the header (states) and sigmas (amino acid).
-func ReadInStrNMap() (MtxMap, MtxMap, []string, []string) {
-	reader := bufio.NewReader(os.Stdin)
-
-	trmapName, err2 := reader.ReadString('\n')
-	if err2 != nil {
-		panic("Trmap name read in error.")
-	}
-	trmapName = strings.TrimSuffix(trmapName, "\n")
-
-	emimapName, err3 := reader.ReadString('\n')
-	if err3 != nil {
-		panic("Emimap name read in error.")
-	}
-	emimapName = strings.TrimSuffix(emimapName, "\n")
-
-	trfile, err4 := os.Open(trmapName)
-	if err4 != nil {
-		fmt.Println("Error: something wrong with openning input files.")
+func ReadMaps(trmapName, emimapName string) (trmap, emimap MtxMap, header, sigma []string, err error) {
+	trfile, err := os.Open(trmapName)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 	defer trfile.Close()
 
-	emifile, err4 := os.Open(emimapName)
-	if err4 != nil {
-		fmt.Println("Error: something wrong with openning input files.")
+	emifile, err := os.Open(emimapName)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 	defer emifile.Close()
 
-	trmap, header := FileToMap(trfile)
-	emimap, sigma := FileToMap(emifile)
-	return trmap, emimap, header, sigma
+	if trmap, header, err = FileToMap(trfile); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%s: %w", trmapName, err)
+	}
+	if emimap, sigma, err = FileToMap(emifile); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%s: %w", emimapName, err)
+	}
+	return trmap, emimap, header, sigma, nil
 }
@@ -0,0 +1,92 @@
+package profilehmm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//sampleSeeds are the Pfam seed alignments of the sample data.
+var sampleSeeds = []struct {
+	name, file string
+}{
+	{"SH3", "sample_data/SH3/Pfam_PF00018_seed.txt"},
+	{"ZincFinger", "sample_data/Zinc_Finger/Pfam_PF00096_seed.txt"},
+}
+
+//buildSample builds the profile HMM of a seed alignment of the sample data
+//with the default theta and pseudocount.
+func buildSample(t *testing.T, name, file string) *ProfileHMM {
+	t.Helper()
+	in, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	aligns, err := ReadAlignmentsPfam(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmm, err := BuildProfileHMM(name, DefaultTheta, DefaultPseudoCount, Amino, aligns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hmm
+}
+
+//TestMapFilesRoundTrip writes the maps of the sample models with Save and
+//checks that LoadProfileHMM gives back exactly the same maps, states and sigma.
+func TestMapFilesRoundTrip(t *testing.T) {
+	for _, seed := range sampleSeeds {
+		t.Run(seed.name, func(t *testing.T) {
+			hmm := buildSample(t, seed.name, seed.file)
+			dir := t.TempDir()
+			trName, emiName := filepath.Join(dir, "TrMap.txt"), filepath.Join(dir, "EmiMap.txt")
+			if err := hmm.Save(trName, emiName); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadProfileHMM(seed.name, trName, emiName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(loaded.Trmap, hmm.Trmap) {
+				t.Error("transition map changed in the round trip")
+			}
+			if !reflect.DeepEqual(loaded.Emimap, hmm.Emimap) {
+				t.Error("emission map changed in the round trip")
+			}
+			if !reflect.DeepEqual(loaded.States, hmm.States) {
+				t.Errorf("states changed in the round trip: %v, want %v", loaded.States, hmm.States)
+			}
+			if !reflect.DeepEqual(loaded.Alphabet, hmm.Alphabet) {
+				t.Errorf("sigma changed in the round trip: %v, want %v", loaded.Alphabet, hmm.Alphabet)
+			}
+		})
+	}
+}
+
+//TestWriteMapExact checks that a map of numbers that 4 decimals can not hold
+//is read back by FileToMap as written.
+func TestWriteMapExact(t *testing.T) {
+	rows, cols := []string{"Start", "M1"}, []string{"A", "B"}
+	theMap := MtxMap{
+		"Start": {"A": 1.0 / 3, "B": 2.0 / 3},
+		"M1":    {"A": 1e-12, "B": 1 - 1e-12},
+	}
+	var buf bytes.Buffer
+	if err := WriteMapExact(&buf, rows, cols, theMap); err != nil {
+		t.Fatal(err)
+	}
+	got, header, err := FileToMap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(header, cols) {
+		t.Errorf("column header is %v, want %v", header, cols)
+	}
+	if !reflect.DeepEqual(got, theMap) {
+		t.Errorf("map read back is %v, want %v", got, theMap)
+	}
+}
@@ -0,0 +1,176 @@
+//This file reads multiple alignments in Stockholm format, the format Pfam gives
+//its seed alignments in. Besides the aligned sequences, a Stockholm file carries
+//markup lines: #=GF about the whole file, #=GS about one sequence, #=GR about
+//each column of one sequence and #=GC about each column of the alignment. The
+//sequences may be split into interleaved blocks, and the alignment ends at "//".
+
+package profilehmm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//StockholmAlignment is an alignment read by ReadAlignmentsStockholm.
+//Names and Alignments are the name and aligned string of each sequence, in the
+//order they first appear. The gaps "." and "-" are both written as "-" and the
+//letters are upper case, like the rows ReadAlignmentsPfam returns.
+//GF maps a feature to its text, GS maps a sequence name to its features, GR maps
+//a sequence name and feature to the column annotation, and GC maps a feature
+//(such as RF or SS_cons) to the column annotation of the alignment.
+type StockholmAlignment struct {
+	Names      []string
+	Alignments []string
+
+	GF map[string]string
+	GS map[string]map[string]string
+	GR map[string]map[string]string
+	GC map[string]string
+}
+
+//ReadAlignmentsStockholm reads the first alignment of a Stockholm file. The blocks
+//of an interleaved file are joined sequence by sequence. It returns an error if the
+//header is missing, a line is malformed, or the rows are not all of the same length.
+func ReadAlignmentsStockholm(file io.Reader) (*StockholmAlignment, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	sto := &StockholmAlignment{
+		GF: make(map[string]string),
+		GS: make(map[string]map[string]string),
+		GR: make(map[string]map[string]string),
+		GC: make(map[string]string),
+	}
+	rows := make(map[string]*strings.Builder)
+	lineNum := 0
+	header := false
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !header {
+			if !strings.HasPrefix(line, "# STOCKHOLM") {
+				return nil, fmt.Errorf("stockholm line %d: missing \"# STOCKHOLM 1.0\" header", lineNum)
+			}
+			header = true
+			continue
+		}
+		if line == "//" {
+			break
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "#=GF":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("stockholm line %d: #=GF without feature", lineNum)
+			}
+			sto.GF[fields[1]] = joinText(sto.GF[fields[1]], restOfLine(line, 2))
+		case "#=GS":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("stockholm line %d: #=GS needs a sequence name and feature", lineNum)
+			}
+			if sto.GS[fields[1]] == nil {
+				sto.GS[fields[1]] = make(map[string]string)
+			}
+			sto.GS[fields[1]][fields[2]] = joinText(sto.GS[fields[1]][fields[2]], restOfLine(line, 3))
+		case "#=GR":
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("stockholm line %d: #=GR needs a sequence name, feature and annotation", lineNum)
+			}
+			if sto.GR[fields[1]] == nil {
+				sto.GR[fields[1]] = make(map[string]string)
+			}
+			sto.GR[fields[1]][fields[2]] += fields[3]
+		case "#=GC":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("stockholm line %d: #=GC needs a feature and annotation", lineNum)
+			}
+			sto.GC[fields[1]] += fields[2]
+		default:
+			if strings.HasPrefix(fields[0], "#") { //other comment lines
+				continue
+			}
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("stockholm line %d: expected name and aligned string, got %d fields", lineNum, len(fields))
+			}
+			if rows[fields[0]] == nil {
+				rows[fields[0]] = &strings.Builder{}
+				sto.Names = append(sto.Names, fields[0])
+			}
+			rows[fields[0]].WriteString(fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !header {
+		return nil, errors.New("stockholm: file is empty")
+	}
+	if len(sto.Names) == 0 {
+		return nil, errors.New("stockholm: no sequences found")
+	}
+
+	for _, name := range sto.Names {
+		row := strings.ToUpper(strings.ReplaceAll(rows[name].String(), ".", "-"))
+		if len(row) != len(rows[sto.Names[0]].String()) {
+			return nil, fmt.Errorf("stockholm: sequence %s has length %d, expected %d", name, len(row), rows[sto.Names[0]].Len())
+		}
+		sto.Alignments = append(sto.Alignments, row)
+	}
+	for feature, annotation := range sto.GC {
+		if len(annotation) != len(sto.Alignments[0]) {
+			return nil, fmt.Errorf("stockholm: #=GC %s has length %d, expected %d", feature, len(annotation), len(sto.Alignments[0]))
+		}
+	}
+	return sto, nil
+}
+
+//MatchColumns uses the reference line (#=GC RF) to decide which columns are match
+//columns, instead of the theta threshold of MarkDeletionState. A column is a match
+//column unless its RF symbol is a gap ("." "-" "_" or "~"). It returns a slice of
+//1 (match) and 0 (insertion) like MarkDeletionState.
+func (sto *StockholmAlignment) MatchColumns() ([]int, error) {
+	rf, ok := sto.GC["RF"]
+	if !ok {
+		return nil, errors.New("stockholm: alignment has no #=GC RF line")
+	}
+	md := make([]int, len(rf))
+	for c := range rf {
+		if !strings.ContainsRune(".-_~", rune(rf[c])) {
+			md[c] = 1
+		}
+	}
+	if SumOfIntSlice(md) == 0 {
+		return nil, errors.New("stockholm: #=GC RF line marks no match column")
+	}
+	return md, nil
+}
+
+//restOfLine returns the line after its first n fields, with the spaces between
+//the remaining words kept.
+func restOfLine(line string, n int) string {
+	for i := 0; i < n; i++ {
+		line = strings.TrimLeft(line, " \t")
+		if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+			line = line[idx:]
+		} else {
+			return ""
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+//joinText adds a continuation line to a markup text, with a space between them.
+func joinText(text, more string) string {
+	if text == "" {
+		return more
+	}
+	return text + " " + more
+}
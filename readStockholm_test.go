@@ -0,0 +1,111 @@
+package profilehmm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//interleavedStockholm is a small Stockholm file in two blocks, with markup of
+//each kind and a feature continued on a second #=GF line.
+const interleavedStockholm = `# STOCKHOLM 1.0
+#=GF ID   SH3_1
+#=GF DE   SH3 domain,
+#=GF DE   first part
+#=GS seq1/1-9 AC P00001.1
+#=GS seq2/3-10 AC P00002.1
+
+seq1/1-9    AC.DE
+seq2/3-10   ac-dF
+#=GR seq1/1-9 SS  HH.HH
+#=GC SS_cons      HH.HH
+#=GC RF           xx.xx
+
+seq1/1-9    GHIK
+seq2/3-10   GH-K
+#=GR seq1/1-9 SS  EEEE
+#=GC SS_cons      EEEE
+#=GC RF           xxx.
+//
+`
+
+//TestReadAlignmentsStockholm checks that the blocks are joined sequence by
+//sequence, that the gaps and letters are written like ReadAlignmentsPfam does,
+//and that each kind of markup is kept.
+func TestReadAlignmentsStockholm(t *testing.T) {
+	sto, err := ReadAlignmentsStockholm(strings.NewReader(interleavedStockholm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"seq1/1-9", "seq2/3-10"}; !reflect.DeepEqual(sto.Names, want) {
+		t.Errorf("names are %q, want %q", sto.Names, want)
+	}
+	if want := []string{"AC-DEGHIK", "AC-DFGH-K"}; !reflect.DeepEqual(sto.Alignments, want) {
+		t.Errorf("alignments are %q, want %q", sto.Alignments, want)
+	}
+	if sto.GF["ID"] != "SH3_1" || sto.GF["DE"] != "SH3 domain, first part" {
+		t.Errorf("GF is %q", sto.GF)
+	}
+	if sto.GS["seq2/3-10"]["AC"] != "P00002.1" {
+		t.Errorf("GS is %q", sto.GS)
+	}
+	if sto.GR["seq1/1-9"]["SS"] != "HH.HHEEEE" {
+		t.Errorf("GR is %q", sto.GR)
+	}
+	if sto.GC["SS_cons"] != "HH.HHEEEE" || sto.GC["RF"] != "xx.xxxxx." {
+		t.Errorf("GC is %q", sto.GC)
+	}
+
+	md, err := sto.MatchColumns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 1, 0, 1, 1, 1, 1, 1, 0}; !reflect.DeepEqual(md, want) {
+		t.Errorf("match columns are %v, want %v", md, want)
+	}
+}
+
+//TestReadAlignmentsStockholmErrors checks the files that ReadAlignmentsStockholm
+//refuses, each with the part of the message that tells what is wrong.
+func TestReadAlignmentsStockholmErrors(t *testing.T) {
+	tests := []struct {
+		name, file, wantErr string
+	}{
+		{"empty file", "", "file is empty"},
+		{"no header", "seq1 ACDE\n//\n", "missing \"# STOCKHOLM 1.0\" header"},
+		{"no sequences", "# STOCKHOLM 1.0\n#=GF ID x\n//\n", "no sequences found"},
+		{"rows of different lengths", "# STOCKHOLM 1.0\nseq1 ACDE\nseq2 ACD\n//\n", "sequence seq2 has length 3, expected 4"},
+		{"GC of another length", "# STOCKHOLM 1.0\nseq1 ACDE\n#=GC RF xxx\n//\n", "#=GC RF has length 3, expected 4"},
+		{"sequence line with three fields", "# STOCKHOLM 1.0\nseq1 AC DE\n//\n", "line 2: expected name and aligned string, got 3 fields"},
+		{"GR without annotation", "# STOCKHOLM 1.0\nseq1 ACDE\n#=GR seq1 SS\n//\n", "line 3: #=GR needs"},
+		{"GS without feature", "# STOCKHOLM 1.0\n#=GS seq1\nseq1 ACDE\n//\n", "line 2: #=GS needs"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadAlignmentsStockholm(strings.NewReader(test.file))
+			if err == nil {
+				t.Fatal("ReadAlignmentsStockholm accepted the file")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error is %q, want it to mention %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+//TestMatchColumnsErrors checks that an alignment without an RF line, or with
+//one that marks no match column, has no match columns.
+func TestMatchColumnsErrors(t *testing.T) {
+	for _, file := range []string{
+		"# STOCKHOLM 1.0\nseq1 ACDE\n//\n",
+		"# STOCKHOLM 1.0\nseq1 ACDE\n#=GC RF .-_~\n//\n",
+	} {
+		sto, err := ReadAlignmentsStockholm(strings.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md, err := sto.MatchColumns(); err == nil {
+			t.Errorf("MatchColumns of %q returned %v", file, md)
+		}
+	}
+}
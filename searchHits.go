@@ -0,0 +1,432 @@
+//This file searches sequences with a profile HMM and reports the hits the way
+//hmmsearch does: a bit score, a correction for biased composition, an E-value,
+//and each domain found in the sequence with its coordinates in the sequence and
+//in the model, its own score and its alignment. The hits are sorted by
+//significance and can be written as a table for people, or as TSV or JSON for
+//scripts.
+
+package profilehmm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+//Null2Omega is the prior probability that a sequence has a biased composition,
+//used to weigh the null2 model in the bias correction (the value of HMMER).
+const Null2Omega = 1.0 / 256
+
+//Domain is one copy of the domain in a hit: the first and last residue (from 1)
+//of the sequence aligned to match states, and the first and last match state
+//they align to. The residues from SeqFrom to SeqTo are scored on their own like
+//a hit (see SearchHit). Included tells if the domain passes the inclusion
+//thresholds of the search. Alignment is the row of the residues in the model
+//from HMMFrom to HMMTo, as in A2M: upper case for match states, lower case for
+//insertions and "-" for deletions.
+type Domain struct {
+	SeqFrom   int     `json:"seq_from"`
+	SeqTo     int     `json:"seq_to"`
+	HMMFrom   int     `json:"hmm_from"`
+	HMMTo     int     `json:"hmm_to"`
+	BitScore  float64 `json:"bit_score"`
+	Score     float64 `json:"score"`
+	Bias      float64 `json:"bias"`
+	PValue    float64 `json:"pvalue"`
+	EValue    float64 `json:"evalue"`
+	Included  bool    `json:"included"`
+	Alignment string  `json:"alignment"`
+}
+
+//Hit is the result of searching one sequence with the model.
+//BitScore is the Forward log odds of the model against the null model in bits.
+//Bias is the part of it explained by the composition of the sequence (null2),
+//and Score = BitScore - Bias is the score the P-value and E-value come from.
+//Domains are in the order of the sequence.
+type Hit struct {
+	Name     string   `json:"target"`
+	Length   int      `json:"length"`
+	BitScore float64  `json:"bit_score"`
+	Score    float64  `json:"score"`
+	Bias     float64  `json:"bias"`
+	PValue   float64  `json:"pvalue"`
+	EValue   float64  `json:"evalue"`
+	Domains  []Domain `json:"domains"`
+}
+
+//SearchOptions are the align mode and the thresholds of a search. MultiDomain
+//lets the model find many copies of the domain in a sequence (not in global
+//mode, which has no room around the domain).
+//A hit is reported if its E-value is at most MaxEValue (0 for no limit) and its
+//Score is at least MinScore. A domain of a hit is included if its E-value is at
+//most IncDomEValue (0 for no limit) and its Score is at least IncDomScore; the
+//other domains are reported but marked. DBSize is the number of sequences the
+//E-values are computed for; if it is 0, the number of sequences searched is used.
+type SearchOptions struct {
+	Mode         AlignMode
+	MultiDomain  bool
+	MaxEValue    float64
+	MinScore     float64
+	IncDomEValue float64
+	IncDomScore  float64
+	DBSize       int
+}
+
+//DefaultSearchOptions find many local domains in each sequence, report the hits
+//with an E-value up to 10 and include the domains with an E-value up to 0.01,
+//like hmmsearch.
+var DefaultSearchOptions = SearchOptions{
+	Mode:         Local,
+	MultiDomain:  true,
+	MaxEValue:    10,
+	MinScore:     math.Inf(-1),
+	IncDomEValue: 0.01,
+	IncDomScore:  math.Inf(-1),
+}
+
+//Search scores every sequence with SearchHit, and returns the hits that pass
+//the thresholds, most significant first. Degenerate letters such as X are
+//scored (see DegenerateAmino); the sequences that still can not be scored, with
+//letters that are neither, are returned as errors naming them and are left out
+//of the hits, so one of them does not stop the search of the others.
+func (hmm *ProfileHMM) Search(names, seqs []string, opts SearchOptions) ([]*Hit, []error) {
+	if opts.DBSize <= 0 {
+		opts.DBSize = len(seqs)
+	}
+	var hits []*Hit
+	var failed []error
+	for i := range seqs {
+		hit, err := hmm.SearchHit(names[i], seqs[i], opts)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", names[i], err))
+			continue
+		}
+		if (opts.MaxEValue > 0 && hit.EValue > opts.MaxEValue) || hit.Score < opts.MinScore {
+			continue
+		}
+		hits = append(hits, hit)
+	}
+	SortHits(hits)
+	return hits, failed
+}
+
+//SortHits sorts the hits by E-value, then by score, then by name.
+func SortHits(hits []*Hit) {
+	sort.SliceStable(hits, func(a, b int) bool {
+		if hits[a].EValue != hits[b].EValue {
+			return hits[a].EValue < hits[b].EValue
+		}
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		return hits[a].Name < hits[b].Name
+	})
+}
+
+//SearchHit scores one sequence with the mode of the options: the bit score from
+//Forward, the null2 bias from the posterior probabilities, the P-value and the
+//E-value for opts.DBSize sequences (at least 1). The domains come from the
+//Viterbi path, which goes through the model once for each copy of the domain
+//(through J in between) with a multi-domain model. Each domain is then scored
+//on its own, with a single domain model configured for its length, as HMMER
+//scores the envelope of a domain, and marked if it passes the inclusion
+//thresholds.
+//The P-value of a model calibrated in the same mode comes from the exponential
+//tail of its Forward scores (see Calibrate). Otherwise, it is the bound
+//2^-Score: under the null model, a likelihood ratio of at least 2^s happens with
+//probability at most 2^-s (Markov's inequality), so true P-values are smaller.
+func (hmm *ProfileHMM) SearchHit(name, str string, opts SearchOptions) (*Hit, error) {
+	if len(str) == 0 {
+		return nil, errors.New("can't search a string of length 0")
+	}
+	mode := opts.Mode.normal()
+	multi := opts.MultiDomain && mode != Global
+	dbSize := opts.DBSize
+	if dbSize < 1 {
+		dbSize = 1
+	}
+	seq := hmm.emi.Encode(str)
+	tr, emi, err := hmm.configure(mode, multi, len(seq))
+	if err != nil {
+		return nil, err
+	}
+	startpoint := hmm.modeStartpoint(mode)
+	post, err := PosteriorDecodingIndexed(startpoint, seq, tr, emi)
+	if err != nil {
+		return nil, err
+	}
+	path, _, err := viterbiPath(startpoint, seq, tr, emi)
+	if err != nil {
+		return nil, err
+	}
+
+	hit := &Hit{Name: name, Length: len(str)}
+	hit.BitScore = (post.LogPr - hmm.nullScore(mode, seq)) / math.Ln2
+	hit.Bias = hmm.null2Bias(seq, emi, post) / math.Ln2
+	hit.Score = hit.BitScore - hit.Bias
+	hit.PValue = hmm.pValue(mode, multi, hit.Score)
+	hit.EValue = EValue(hit.PValue, dbSize)
+
+	hit.Domains = pathDomains(path, str)
+	for d := range hit.Domains {
+		domain := &hit.Domains[d]
+		if mode == Global { //the domain is the whole sequence.
+			domain.BitScore, domain.Score, domain.Bias = hit.BitScore, hit.Score, hit.Bias
+		} else if err := hmm.scoreDomain(mode, seq[domain.SeqFrom-1:domain.SeqTo], domain); err != nil {
+			return nil, fmt.Errorf("domain %d: %w", d+1, err)
+		}
+		domain.PValue = hmm.pValue(mode, multi, domain.Score)
+		domain.EValue = EValue(domain.PValue, dbSize)
+		domain.Included = (opts.IncDomEValue <= 0 || domain.EValue <= opts.IncDomEValue) && domain.Score >= opts.IncDomScore
+	}
+	return hit, nil
+}
+
+//scoreDomain fills in the scores of the domain, from the residues of the
+//sequence it covers, with a single domain model of the mode.
+func (hmm *ProfileHMM) scoreDomain(mode AlignMode, seq []int, domain *Domain) error {
+	tr, emi, err := hmm.configure(mode, false, len(seq))
+	if err != nil {
+		return err
+	}
+	post, err := PosteriorDecodingIndexed(hmm.modeStartpoint(mode), seq, tr, emi)
+	if err != nil {
+		return err
+	}
+	domain.BitScore = (post.LogPr - hmm.nullScore(mode, seq)) / math.Ln2
+	domain.Bias = hmm.null2Bias(seq, emi, post) / math.Ln2
+	domain.Score = domain.BitScore - domain.Bias
+	return nil
+}
+
+//pValue returns the P-value of a score in bits, from the calibration of the
+//model if it was made in the same mode, or the bound 2^-score otherwise.
+func (hmm *ProfileHMM) pValue(mode AlignMode, multi bool, score float64) float64 {
+	if c := hmm.Calibration; c != nil && c.fits(mode, multi) {
+		return c.ForwardPValue(score)
+	}
+	return math.Min(1, math.Exp2(-score))
+}
+
+//null2Bias returns the bias correction of the score in nats. The null2 model
+//emits each residue with the average, over the positions of the sequence, of
+//the emissions the model expects there (the posterior weighted emissions of
+//the states of emi, which include the flanking states outside global mode). If
+//the sequence scores well only because its composition is like that of the
+//model (a low complexity region), null2 explains it as well as the model does.
+//The correction is ln(1 + omega * Pr(x|null2)/Pr(x|null)), as in HMMER.
+func (hmm *ProfileHMM) null2Bias(seq []int, emi *DenseMtx, post *Posterior) float64 {
+	null2 := make([]float64, len(hmm.Alphabet))
+	for i := range seq {
+		for v, pr := range post.Prob[i] {
+			if pr == 0 {
+				continue
+			}
+			for a := range null2 {
+				null2[a] += pr * emi.At(v, a) / float64(len(seq))
+			}
+		}
+	}
+	background := make([]float64, len(hmm.Alphabet))
+	for a, letter := range hmm.Alphabet {
+		background[a] = hmm.Null[letter]
+	}
+	null2Score := 0.0
+	for _, a := range seq {
+		null2Score += math.Log(emi.Mix(null2, a) / emi.Mix(background, a))
+	}
+	return LogAdd(0, math.Log(Null2Omega)+null2Score)
+}
+
+//pathDomains finds the domains in a path written like the one of
+//ViterbiDecoding, of the string. A domain starts each time the path goes into
+//the model (after Start, N or J) and ends when it leaves it; it spans the
+//residues emitted by its match states. The paths that go through no match
+//state give no domain.
+func pathDomains(path, str string) []Domain {
+	var domains []Domain
+	var domain Domain
+	var row, pending strings.Builder //pending holds the insertions and deletions after the last match state.
+	inDomain := false
+	residue := 0
+	finish := func() {
+		if inDomain {
+			domain.Alignment = row.String()
+			domains = append(domains, domain)
+		}
+		inDomain = false
+		row.Reset()
+		pending.Reset()
+	}
+
+	for _, state := range strings.Fields(path) {
+		switch state[0] {
+		case 'N', 'J', 'C':
+			residue++
+			finish()
+		case 'E':
+			finish()
+		case 'M':
+			residue++
+			var k int
+			fmt.Sscanf(state[1:], "%d", &k)
+			if !inDomain {
+				domain = Domain{SeqFrom: residue, HMMFrom: k}
+				inDomain = true
+			}
+			row.WriteString(pending.String())
+			pending.Reset()
+			row.WriteString(str[residue-1 : residue])
+			domain.SeqTo, domain.HMMTo = residue, k
+		case 'I':
+			residue++
+			if inDomain {
+				pending.WriteString(strings.ToLower(str[residue-1 : residue]))
+			}
+		case 'D':
+			if inDomain {
+				pending.WriteByte('-')
+			}
+		}
+	}
+	finish()
+	return domains
+}
+
+//WriteHitsText writes the hits of the model as a table for people, with a
+//header saying what was searched, with which thresholds, and where the E-values
+//come from; then the domains of each hit, with "!" for the included ones and
+//"?" for the others, and the alignment of each domain (see AlignmentView) in
+//blocks of width columns.
+func WriteHitsText(w io.Writer, hmm *ProfileHMM, numSearched int, opts SearchOptions, hits []*Hit, width int) {
+	fmt.Fprintf(w, "# query:    %s  [M=%d]\n", hmm.Name, hmm.Length)
+	fmt.Fprintf(w, "# mode:     %s", opts.Mode.normal())
+	if opts.MultiDomain && opts.Mode.normal() != Global {
+		fmt.Fprint(w, ", multi-domain")
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "# targets:  %d searched", numSearched)
+	if opts.DBSize > 0 {
+		fmt.Fprintf(w, ", E-values for a database of %d", opts.DBSize)
+	}
+	fmt.Fprintln(w)
+	if c := hmm.Calibration; c != nil && c.fits(opts.Mode, opts.MultiDomain) {
+		fmt.Fprintf(w, "# E-values: calibrated, Forward tail tau %.4f lambda %.4f\n", c.ForwardTau, c.ForwardLambda)
+	} else {
+		fmt.Fprintf(w, "# E-values: not calibrated in %s mode, upper bound from 2^-score\n", opts.Mode.normal())
+	}
+	fmt.Fprintf(w, "# report:   %s; %d hits\n", thresholds(opts.MaxEValue, opts.MinScore), len(hits))
+	fmt.Fprintf(w, "# include:  domains with %s\n#\n", thresholds(opts.IncDomEValue, opts.IncDomScore))
+
+	nameWidth := len("target")
+	for _, hit := range hits {
+		if len(hit.Name) > nameWidth {
+			nameWidth = len(hit.Name)
+		}
+	}
+	fmt.Fprintf(w, "%9s %8s %6s %9s  %-*s %6s %4s\n", "E-value", "score", "bias", "bit score", nameWidth, "target", "length", "#dom")
+	fmt.Fprintf(w, "%9s %8s %6s %9s  %-*s %6s %4s\n", "-------", "-----", "----", "---------", nameWidth, "------", "------", "----")
+	for _, hit := range hits {
+		fmt.Fprintf(w, "%9.2g %8.1f %6.1f %9.1f  %-*s %6d %4d\n", hit.EValue, hit.Score, hit.Bias, hit.BitScore, nameWidth, hit.Name, hit.Length, len(hit.Domains))
+	}
+	if len(hits) == 0 {
+		fmt.Fprintln(w, "   [No hits detected that satisfy reporting thresholds]")
+		return
+	}
+
+	fmt.Fprint(w, "\n# domains of each hit (! included, ? not included)\n")
+	for _, hit := range hits {
+		fmt.Fprintf(w, "\n>> %s\n", hit.Name)
+		fmt.Fprintf(w, "%4s %s %9s %8s %6s %13s %13s\n", "#", " ", "E-value", "score", "bias", "seq from..to", "hmm from..to")
+		for d, domain := range hit.Domains {
+			mark := "?"
+			if domain.Included {
+				mark = "!"
+			}
+			fmt.Fprintf(w, "%4d %s %9.2g %8.1f %6.1f %13s %13s\n", d+1, mark, domain.EValue, domain.Score, domain.Bias,
+				fmt.Sprintf("%d..%d", domain.SeqFrom, domain.SeqTo), fmt.Sprintf("%d..%d", domain.HMMFrom, domain.HMMTo))
+		}
+		for d, domain := range hit.Domains {
+			fmt.Fprintf(w, "\n  == domain %d  score: %.1f bits;  E-value: %.2g\n", d+1, domain.Score, domain.EValue)
+			hmm.AlignmentView(hit.Name, domain).Write(w, width)
+		}
+	}
+}
+
+//thresholds writes an E-value and a score threshold for the header of
+//WriteHitsText, leaving out those that do not limit anything.
+func thresholds(maxEValue, minScore float64) string {
+	text := "any E-value"
+	if maxEValue > 0 {
+		text = fmt.Sprintf("E-value <= %g", maxEValue)
+	}
+	if !math.IsInf(minScore, -1) {
+		text += fmt.Sprintf(", score >= %g", minScore)
+	}
+	return text
+}
+
+//WriteHitsTSV writes the domains of the hits as tab separated values with a
+//header line, one row per domain, with the values of its hit first. The
+//included column is 1 or 0.
+func WriteHitsTSV(w io.Writer, hits []*Hit) {
+	fmt.Fprintln(w, "target\tlength\tevalue\tpvalue\tscore\tbias\tbit_score\tndom\tdom\tdom_evalue\tdom_pvalue\tdom_score\tdom_bias\tdom_bit_score\tincluded\tseq_from\tseq_to\thmm_from\thmm_to\talignment")
+	for _, hit := range hits {
+		for d, domain := range hit.Domains {
+			included := 0
+			if domain.Included {
+				included = 1
+			}
+			fmt.Fprintf(w, "%s\t%d\t%g\t%g\t%.4f\t%.4f\t%.4f\t%d\t", hit.Name, hit.Length, hit.EValue, hit.PValue,
+				hit.Score, hit.Bias, hit.BitScore, len(hit.Domains))
+			fmt.Fprintf(w, "%d\t%g\t%g\t%.4f\t%.4f\t%.4f\t%d\t%d\t%d\t%d\t%d\t%s\n", d+1, domain.EValue, domain.PValue,
+				domain.Score, domain.Bias, domain.BitScore, included, domain.SeqFrom, domain.SeqTo, domain.HMMFrom, domain.HMMTo, domain.Alignment)
+		}
+	}
+}
+
+//WriteHitsJSON writes the query, its calibration, the thresholds and the hits
+//as one JSON object.
+func WriteHitsJSON(w io.Writer, hmm *ProfileHMM, numSearched int, opts SearchOptions, hits []*Hit) error {
+	report := struct {
+		Query        string       `json:"query"`
+		ModelLength  int          `json:"model_length"`
+		Mode         AlignMode    `json:"mode"`
+		MultiDomain  bool         `json:"multi_domain"`
+		Calibration  *Calibration `json:"calibration,omitempty"`
+		Searched     int          `json:"searched"`
+		DBSize       int          `json:"db_size,omitempty"`
+		MaxEValue    float64      `json:"max_evalue,omitempty"`
+		MinScore     *float64     `json:"min_score,omitempty"`
+		IncDomEValue float64      `json:"inc_dom_evalue,omitempty"`
+		IncDomScore  *float64     `json:"inc_dom_score,omitempty"`
+		Hits         []*Hit       `json:"hits"`
+	}{
+		Query:        hmm.Name,
+		ModelLength:  hmm.Length,
+		Mode:         opts.Mode.normal(),
+		MultiDomain:  opts.MultiDomain && opts.Mode.normal() != Global,
+		Calibration:  hmm.Calibration,
+		Searched:     numSearched,
+		DBSize:       opts.DBSize,
+		MaxEValue:    opts.MaxEValue,
+		IncDomEValue: opts.IncDomEValue,
+		Hits:         hits,
+	}
+	if !math.IsInf(opts.MinScore, -1) {
+		report.MinScore = &opts.MinScore
+	}
+	if !math.IsInf(opts.IncDomScore, -1) {
+		report.IncDomScore = &opts.IncDomScore
+	}
+	if report.Hits == nil {
+		report.Hits = []*Hit{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
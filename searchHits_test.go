@@ -0,0 +1,203 @@
+package profilehmm
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//searchFasta mixes SH3 domains (one in lower case with an X, one with two
+//copies of the domain) with a zinc finger, a low complexity sequence and a
+//record with digits, which can not be scored.
+const searchFasta = `>sh3_a
+AEYDYEAAEDNELTFEENDKIINIEFVDDDWWLGELEKTGEKGLFPS
+>zinc_finger
+MSRRYKCGECGKTFSRSTHLTQHQRVHTGEKPY
+>sh3_x lower case, with an X
+iakfdyaptqsdemglrigdtvlisxkvdaewfygenqnqrtfgivps
+>bad
+MKV12345
+>low_complexity
+GSGSGSGSGSGSGSGSGSGSGSGSGSGSGSGSGSGS
+>sh3_two
+EALFSYEATQPEDLEFQEGDIILVLSKVNEEWLEGECKGKVGIFPKGGSGGSG
+TAIYDYNSNEAGDLNFAVGSQIMVTARVNEEWLEGECFGRSGIFPS
+`
+
+//searchSample searches searchFasta with the SH3 model, with the default options
+//but the E-value threshold.
+func searchSample(t *testing.T, maxEValue float64) (*ProfileHMM, []string, SearchOptions, []*Hit, []error) {
+	t.Helper()
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	names, seqs, err := ReadFasta(strings.NewReader(searchFasta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultSearchOptions
+	opts.MaxEValue = maxEValue
+	hits, failed := hmm.Search(names, seqs, opts)
+	return hmm, seqs, opts, hits, failed
+}
+
+//hitNames returns the names of the hits in their order.
+func hitNames(hits []*Hit) []string {
+	var names []string
+	for _, hit := range hits {
+		names = append(names, hit.Name)
+	}
+	return names
+}
+
+//TestSearch checks that the record that can not be scored is the only one left
+//out, that the hits are sorted by E-value with the SH3 domains first, and that
+//the E-value threshold keeps exactly the hits below it.
+func TestSearch(t *testing.T) {
+	_, _, _, all, failed := searchSample(t, 0)
+	if len(failed) != 1 || !strings.HasPrefix(failed[0].Error(), "bad:") {
+		t.Errorf("failed = %v, want only the record bad", failed)
+	}
+	if len(all) != 5 {
+		t.Fatalf("%d hits without a threshold, want 5: %v", len(all), hitNames(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].EValue < all[i-1].EValue {
+			t.Errorf("hit %s (E-value %g) is after %s (E-value %g)", all[i].Name, all[i].EValue, all[i-1].Name, all[i-1].EValue)
+		}
+	}
+	if got, want := hitNames(all[:3]), []string{"sh3_two", "sh3_a", "sh3_x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("best hits are %v, want %v", got, want)
+	}
+
+	const maxEValue = 0.01
+	_, _, _, hits, _ := searchSample(t, maxEValue)
+	var want []string
+	for _, hit := range all {
+		if hit.EValue <= maxEValue {
+			want = append(want, hit.Name)
+		}
+	}
+	if got := hitNames(hits); !reflect.DeepEqual(got, want) || len(got) != 3 {
+		t.Errorf("hits with E-value up to %g are %v, want the 3 SH3 hits %v", maxEValue, got, want)
+	}
+}
+
+//TestWriteHits checks that the TSV output has a row for each domain of each
+//hit in the order of the hits, and that the JSON output decodes back to the
+//hits and the number of sequences searched.
+func TestWriteHits(t *testing.T) {
+	hmm, seqs, opts, hits, _ := searchSample(t, 0.01)
+
+	var tsv bytes.Buffer
+	WriteHitsTSV(&tsv, hits)
+	lines := strings.Split(strings.TrimSpace(tsv.String()), "\n")
+	if !strings.HasPrefix(lines[0], "target\tlength\tevalue") {
+		t.Errorf("TSV header is %q", lines[0])
+	}
+	var rows []string
+	for _, hit := range hits {
+		for range hit.Domains {
+			rows = append(rows, hit.Name)
+		}
+	}
+	if len(lines)-1 != len(rows) || len(rows) != 4 {
+		t.Fatalf("TSV has %d rows, want %d (one per domain)", len(lines)-1, len(rows))
+	}
+	for i, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 20 || fields[0] != rows[i] {
+			t.Errorf("TSV row %d has %d fields for %s, want 20 for %s", i+1, len(fields), fields[0], rows[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WriteHitsJSON(&out, hmm, len(seqs), opts, hits); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Query    string `json:"query"`
+		Searched int    `json:"searched"`
+		Hits     []*Hit `json:"hits"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Query != "SH3" || report.Searched != len(seqs) {
+		t.Errorf("JSON query %q searched %d, want SH3 and %d", report.Query, report.Searched, len(seqs))
+	}
+	if !reflect.DeepEqual(report.Hits, hits) {
+		t.Errorf("JSON hits are %v, want %v", hitNames(report.Hits), hitNames(hits))
+	}
+}
+
+//TestPathDomains finds the domains of hand made paths: the flanking residues
+//before the first match state, the insertions and deletions between match
+//states, those after the last one (which are not part of the domain), and two
+//domains joined by J.
+func TestPathDomains(t *testing.T) {
+	tests := []struct {
+		path, str string
+		want      []Domain
+	}{
+		{"Start N N M1 M2 I2 M3 C End", "ABCDEF",
+			[]Domain{{SeqFrom: 3, SeqTo: 6, HMMFrom: 1, HMMTo: 3, Alignment: "CDeF"}}},
+		{"Start N M1 I1 D2 C End", "ABCD",
+			[]Domain{{SeqFrom: 2, SeqTo: 2, HMMFrom: 1, HMMTo: 1, Alignment: "B"}}},
+		{"Start M1 D2 M3 J M2 M3 C End", "ABCDEF", []Domain{
+			{SeqFrom: 1, SeqTo: 2, HMMFrom: 1, HMMTo: 3, Alignment: "A-B"},
+			{SeqFrom: 4, SeqTo: 5, HMMFrom: 2, HMMTo: 3, Alignment: "DE"}}},
+		{"Start N I0 C End", "ABC", nil},
+	}
+	for _, test := range tests {
+		if got := pathDomains(test.path, test.str); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("pathDomains(%q, %q) = %+v, want %+v", test.path, test.str, got, test.want)
+		}
+	}
+}
+
+//TestTwoDomains searches a sequence of two SH3 domains joined by a linker. The
+//multi-domain model finds both, each where it is in the sequence and over
+//(almost) the whole model, and the null2 bias is within the bit score; the
+//single domain model finds one.
+func TestTwoDomains(t *testing.T) {
+	hmm := buildSample(t, "SH3", "sample_data/SH3/Pfam_PF00018_seed.txt")
+	first := "EALFSYEATQPEDLEFQEGDIILVLSKVNEEWLEGECKGKVGIFPK"
+	second := "TAIYDYNSNEAGDLNFAVGSQIMVTARVNEEWLEGECFGRSGIFPS"
+	str := first + "GGSGGSG" + second
+
+	hit, err := hmm.SearchHit("two", str, DefaultSearchOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hit.Bias < 0 || hit.Bias > hit.BitScore || hit.Score != hit.BitScore-hit.Bias {
+		t.Errorf("bit score %g, bias %g and score %g do not add up", hit.BitScore, hit.Bias, hit.Score)
+	}
+	want := [][4]int{{2, 45, 2, 47}, {55, 99, 2, 48}}
+	if len(hit.Domains) != len(want) {
+		t.Fatalf("%d domains, want %d: %+v", len(hit.Domains), len(want), hit.Domains)
+	}
+	for d, domain := range hit.Domains {
+		got := [4]int{domain.SeqFrom, domain.SeqTo, domain.HMMFrom, domain.HMMTo}
+		if got != want[d] {
+			t.Errorf("domain %d is at residues %d..%d and states %d..%d, want %d..%d and %d..%d",
+				d+1, got[0], got[1], got[2], got[3], want[d][0], want[d][1], want[d][2], want[d][3])
+		}
+		if residues := strings.ToUpper(strings.ReplaceAll(domain.Alignment, "-", "")); residues != str[domain.SeqFrom-1:domain.SeqTo] {
+			t.Errorf("domain %d aligns %s, not the residues %s", d+1, residues, str[domain.SeqFrom-1:domain.SeqTo])
+		}
+		if !domain.Included {
+			t.Errorf("domain %d (E-value %g) is not included", d+1, domain.EValue)
+		}
+	}
+
+	opts := DefaultSearchOptions
+	opts.MultiDomain = false
+	hit, err = hmm.SearchHit("two", str, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hit.Domains) != 1 {
+		t.Errorf("single domain model finds %d domains, want 1", len(hit.Domains))
+	}
+}
@@ -0,0 +1,128 @@
+//This file contains Transitions, the sparse form of a transition matrix used by
+//Forward and Viterbi. A profile HMM made by MakeMapHeader only lets M/D/I(k) move
+//to M/D(k+1) and I(k), so each state has at most three states coming into it.
+//Looping over those instead of over every state makes the algorithms run in time
+//linear to the model length instead of quadratic to the number of states.
+
+package profilehmm
+
+import (
+	"math"
+)
+
+//Transitions lists, for each state (by index), the states it can be reached
+//from, with the probability and log probability of each of those transitions.
+//To and ToLogProb list the same transitions the other way around, the states
+//each state can go to, for the algorithms that run backward.
+type Transitions struct {
+	States  []string
+	From    [][]int
+	Prob    [][]float64
+	LogProb [][]float64
+
+	To        [][]int
+	ToLogProb [][]float64
+}
+
+//NewTransitions takes a dense transition matrix and keeps only the transitions
+//that can happen. If the states are the header of a profile HMM (see
+//ProfileLength), the candidates come from the profile topology; otherwise every
+//non zero entry of the matrix is kept.
+func NewTransitions(tr *DenseMtx) *Transitions {
+	states := tr.RowHeader
+	candidates := ProfileTopology(states)
+	if candidates == nil {
+		candidates = make([][]int, len(states))
+		for v2 := range states {
+			for v1 := range states {
+				candidates[v2] = append(candidates[v2], v1)
+			}
+		}
+	}
+
+	trans := newTransitions(states)
+	for v2, from := range candidates {
+		for _, v1 := range from {
+			if pr := tr.At(v1, v2); pr != 0 {
+				trans.add(v1, v2, pr)
+			}
+		}
+	}
+	return trans
+}
+
+//newTransitions makes the Transitions of the states without any transition;
+//add puts them in one by one.
+func newTransitions(states []string) *Transitions {
+	return &Transitions{
+		States:  states,
+		From:    make([][]int, len(states)),
+		Prob:    make([][]float64, len(states)),
+		LogProb: make([][]float64, len(states)),
+
+		To:        make([][]int, len(states)),
+		ToLogProb: make([][]float64, len(states)),
+	}
+}
+
+//add puts in the transition from state v1 to state v2 with probability pr.
+func (trans *Transitions) add(v1, v2 int, pr float64) {
+	trans.From[v2] = append(trans.From[v2], v1)
+	trans.Prob[v2] = append(trans.Prob[v2], pr)
+	trans.LogProb[v2] = append(trans.LogProb[v2], math.Log(pr))
+	trans.To[v1] = append(trans.To[v1], v2)
+	trans.ToLogProb[v1] = append(trans.ToLogProb[v1], math.Log(pr))
+}
+
+//ProfileLength tells if the states are the header made by MakeMapHeader, and
+//if so, the number of match states.
+func ProfileLength(states []string) (int, bool) {
+	if len(states) < 3 || len(states)%3 != 0 {
+		return 0, false
+	}
+	numMatch := len(states)/3 - 1
+	header := MakeMapHeader(numMatch)
+	for i := range header {
+		if header[i] != states[i] {
+			return 0, false
+		}
+	}
+	return numMatch, true
+}
+
+//ProfileTopology returns, for each state of a profile HMM header, the indexes of
+//the states that may transit into it: Start and I0 go to I0, M1 and D1; M/D/I(k)
+//go to M/D(k+1) and I(k); M/D/I of the last node go to End. Predecessors always
+//come before the state in the header, except for the self loop of insertions.
+//It returns nil if the states are not a profile HMM header.
+func ProfileTopology(states []string) [][]int {
+	numMatch, ok := ProfileLength(states)
+	if !ok {
+		return nil
+	}
+	//index of the states of node k in the header; node 0 has Start in place of M.
+	m := func(k int) int { return 3*k - 1 }
+	d := func(k int) int { return 3 * k }
+	ins := func(k int) int { return 3*k + 1 }
+
+	from := make([][]int, len(states))
+	from[ins(0)] = []int{0, ins(0)}
+	for k := 1; k <= numMatch; k++ {
+		var prev []int
+		if k == 1 {
+			prev = []int{0, ins(0)}
+		} else {
+			prev = []int{m(k - 1), d(k - 1), ins(k - 1)}
+		}
+		from[m(k)] = prev
+		from[d(k)] = prev
+		from[ins(k)] = []int{m(k), d(k), ins(k)}
+	}
+	end := len(states) - 1
+	if numMatch == 0 {
+		from[end] = []int{0, ins(0)}
+	} else {
+		from[end] = []int{m(numMatch), d(numMatch), ins(numMatch)}
+	}
+	return from
+}